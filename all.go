@@ -0,0 +1,97 @@
+package nfstools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// ExtractWithContext extracts every header below root, naming entries
+// like BuildOutputPath and reading them from archives[hdr.ArchiveID]. It
+// stops at the first failure, or as soon as ctx is done, in which case it
+// returns the error of ctx. A file being written when ctx is done is
+// removed. opts.Sum is not used.
+func ExtractWithContext(ctx context.Context, archives []io.ReaderAt, headers []Header, hashList HashList, root string, shift uint, opts CopyOptions) error {
+	return extractAll(ctx, DiskSink{}, archives, headers, hashList, root, shift, opts)
+}
+
+// ExtractAll reads every header into memory instead of writing files. The
+// result is keyed by the slash separated path BuildOutputPath gives each
+// entry below an empty root.
+func ExtractAll(headers []Header, hashList HashList, archives []io.ReaderAt, shift uint) (map[string][]byte, error) {
+	sink := make(MemorySink)
+	if err := extractAll(context.Background(), sink, archives, headers, hashList, "", shift, CopyOptions{}); err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte, len(sink))
+	for p, data := range sink {
+		files[filepath.ToSlash(p)] = data
+	}
+	return files, nil
+}
+
+func extractAll(ctx context.Context, sink OutputSink, archives []io.ReaderAt, headers []Header, hashList HashList, root string, shift uint, opts CopyOptions) error {
+	opts.Sum = nil
+	for _, hdr := range headers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Names escaping root are extracted under UnknownDir instead
+		outPath, _ := BuildOutputPath(root, hashList, hdr)
+		if uint(hdr.ArchiveID) >= uint(len(archives)) {
+			return fmt.Errorf("entry %08X: %w: archive %d of %d", hdr.NameHash, ErrArchiveIndexOutOfRange, hdr.ArchiveID, len(archives))
+		}
+		offset, err := ResolveOffset(hdr, shift)
+		if err != nil {
+			return err
+		}
+		if _, err := extractToSink(ctx, sink, archives[hdr.ArchiveID], outPath, offset, int64(hdr.Size), opts); err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// MemorySink keeps created files in memory, keyed by the path they were
+// created with. It is not safe for concurrent use.
+type MemorySink map[string][]byte
+
+// Create implements OutputSink. The file appears in the map once closed.
+func (m MemorySink) Create(path string) (io.WriteCloser, error) {
+	return &memFile{sink: m, path: path}, nil
+}
+
+type memFile struct {
+	bytes.Buffer
+	sink MemorySink
+	path string
+}
+
+func (f *memFile) Close() error {
+	f.sink[f.path] = f.Bytes()
+	return nil
+}
+
+func (f *memFile) Abort() error {
+	return nil
+}
+
+// ctxReader fails reads once its context is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// expandArchives expands a numeric {A..B} range in each path, the way the
+// usage text writes ZZDATA{0..3}, so it works without shell support. Paths
+// that exist as written are left alone, except for directories, which
+// stand for the archive parts inside them.
+func expandArchives(paths []string) ([]string, error) {
+	var expanded []string
+	for _, p := range paths {
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			parts, err := archiveParts(p)
+			if err != nil {
+				return nil, err
+			}
+			expanded = append(expanded, parts...)
+			continue
+		}
+		names, ok := expandRange(p)
+		if !ok {
+			expanded = append(expanded, p)
+			continue
+		}
+		if _, err := os.Stat(p); err == nil {
+			expanded = append(expanded, p)
+			continue
+		}
+		for _, name := range names {
+			if _, err := os.Stat(name); err != nil {
+				return nil, fmt.Errorf("%s: %w", p, err)
+			}
+		}
+		expanded = append(expanded, names...)
+	}
+	return expanded, nil
+}
+
+// expandRange expands the first {A..B} in p. Leading zeros on either bound
+// pad every number to the same width.
+func expandRange(p string) ([]string, bool) {
+	open := strings.Index(p, "{")
+	if open < 0 {
+		return nil, false
+	}
+	length := strings.Index(p[open:], "}")
+	if length < 0 {
+		return nil, false
+	}
+	prefix, body, suffix := p[:open], p[open+1:open+length], p[open+length+1:]
+
+	loText, hiText, ok := strings.Cut(body, "..")
+	if !ok {
+		return nil, false
+	}
+	lo, err := strconv.Atoi(loText)
+	if err != nil || lo < 0 {
+		return nil, false
+	}
+	hi, err := strconv.Atoi(hiText)
+	if err != nil || hi < lo {
+		return nil, false
+	}
+
+	width := 0
+	if len(loText) > 1 && loText[0] == '0' || len(hiText) > 1 && hiText[0] == '0' {
+		width = max(len(loText), len(hiText))
+	}
+	names := make([]string, 0, hi-lo+1)
+	for i := lo; i <= hi; i++ {
+		names = append(names, fmt.Sprintf("%s%0*d%s", prefix, width, i, suffix))
+	}
+	return names, true
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// bundleWriter adds files to a single output archive.
+type bundleWriter interface {
+	create(name string, size int64) (io.Writer, error)
+	Close() error
+}
+
+type tarBundle struct{ *tar.Writer }
+
+func (b tarBundle) create(name string, size int64) (io.Writer, error) {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0o644,
+		Format:   tar.FormatPAX,
+	}
+	if err := b.WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+	return b.Writer, nil
+}
+
+type zipBundle struct{ *zip.Writer }
+
+func (b zipBundle) create(name string, size int64) (io.Writer, error) {
+	return b.Create(name)
+}
+
+// bundle writes every entry into b instead of the file system, naming each
+// after its path below root. It stops at the first failure since a
+// partially written member cannot be taken back.
+func (x *extractor) bundle(ctx context.Context, b bundleWriter, entries []entry, root string) error {
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, outPath := e.hdr, e.outPath
+		if !e.known && x.guessExt {
+			outPath += x.peekExt(hdr)
+		}
+		rel, err := filepath.Rel(root, outPath)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		var n int64
+		var sum hash.Hash
+		if x.digests != nil {
+			sum = sha256.New()
+		}
+		if hdr.Size == 0 && x.failOnEmpty {
+			err = fmt.Errorf("entry %08X is empty", hdr.NameHash)
+		} else if x.decompress {
+			// The inflated size is only known afterwards
+			var buf bytes.Buffer
+			n, err = x.extract(ctx, hdr, "", &buf, sum)
+			if err == nil {
+				var w io.Writer
+				if w, err = b.create(name, n); err == nil {
+					_, err = buf.WriteTo(w)
+				}
+			}
+		} else {
+			var w io.Writer
+			if w, err = b.create(name, int64(hdr.Size)); err == nil {
+				n, err = x.extract(ctx, hdr, "", w, sum)
+			}
+		}
+		if err != nil {
+			x.stats.failed++
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		if x.verbosity > quiet {
+			x.print(e, name)
+		}
+		x.stats.extracted++
+		x.stats.bytes += n
+		x.stats.stored += int64(hdr.Size)
+		if !e.known {
+			x.stats.unknown++
+		}
+		if hdr.Size == 0 {
+			x.stats.empty++
+		}
+		if sum != nil {
+			x.digests[e.index] = sum.Sum(nil)
+		}
+	}
+	return b.Close()
+}
+
+// writeBundle creates file and fills it with entries in the given format.
+func (x *extractor) writeBundle(ctx context.Context, file string, zipped bool, entries []entry, root string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	var b bundleWriter = tarBundle{tar.NewWriter(f)}
+	if zipped {
+		b = zipBundle{zip.NewWriter(f)}
+	}
+	if err := x.bundle(ctx, b, entries, root); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
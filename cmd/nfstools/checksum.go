@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"nfstools"
+)
+
+// runChecksum recomputes the checksum of every entry of a ZDIR2003 straight
+// from the archives and prints it next to the stored one.
+func runChecksum(args []string) {
+	fs := newFlagSet("checksum")
+	shift := fs.Uint("offset-shift", nfstools.OffsetShift, "entry offsets are in units of 1<<`n` bytes")
+	forceFormat := formatFlag(fs)
+	fs.Parse(args)
+
+	if fs.NArg() < 2 {
+		usageError(fs)
+	}
+
+	headers, format, err := loadHeaders(fs.Arg(0), *forceFormat)
+	if err != nil {
+		exitWith(exitNoZDIR, "Failed to load headers: %v", err)
+	}
+	if format != nfstools.Format2003 {
+		exitWithError("%s: ZDIR%s has no checksums", fs.Arg(0), format)
+	}
+
+	archives, err := openArchives(fs.Args()[1:])
+	if err != nil {
+		exitWithError("Failed to open archive: %v", err)
+	}
+	defer closeArchives(archives)
+
+	var bad int
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HASH\tSTORED\tCOMPUTED\tMATCH")
+	for _, hdr := range headers {
+		sum, err := computeChecksum(archives, hdr, *shift)
+		if err != nil {
+			tw.Flush()
+			fmt.Fprintln(os.Stderr, err)
+			bad++
+			continue
+		}
+		if sum != hdr.Checksum {
+			bad++
+		}
+		fmt.Fprintf(tw, "%08X\t%08X\t%08X\t%t\n", hdr.NameHash, hdr.Checksum, sum, sum == hdr.Checksum)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(os.Stderr, "%d entries checked, %d bad\n", len(headers), bad)
+	if bad > 0 {
+		os.Exit(exitError)
+	}
+}
+
+// computeChecksum hashes the stored bytes of hdr without writing them
+// anywhere.
+func computeChecksum(archives []*os.File, hdr nfstools.Header, shift uint) (uint32, error) {
+	if uint(hdr.ArchiveID) >= uint(len(archives)) {
+		return 0, fmt.Errorf("entry %08X: %w: references archive %d but only %d given", hdr.NameHash, nfstools.ErrArchiveIndexOutOfRange, hdr.ArchiveID, len(archives))
+	}
+	offset, err := nfstools.ResolveOffset(hdr, shift)
+	if err != nil {
+		return 0, err
+	}
+
+	opts := nfstools.CopyOptions{Sum: nfstools.NewChecksum()}
+	if _, err := nfstools.ExtractTo(io.Discard, archives[hdr.ArchiveID], offset, int64(hdr.Size), opts); err != nil {
+		return 0, fmt.Errorf("entry %08X: %w", hdr.NameHash, err)
+	}
+	return opts.Sum.Sum32(), nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"hash"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"nfstools"
+)
+
+// hashingSink creates files through nfstools.DiskSink, feeding everything
+// written to them into sum.
+type hashingSink struct {
+	sum hash.Hash
+}
+
+func (s hashingSink) Create(path string) (io.WriteCloser, error) {
+	w, err := nfstools.DiskSink{}.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &hashingFile{Writer: io.MultiWriter(w, s.sum), file: w}, nil
+}
+
+type hashingFile struct {
+	io.Writer
+	file io.WriteCloser
+}
+
+func (f *hashingFile) Close() error {
+	return f.file.Close()
+}
+
+func (f *hashingFile) Abort() error {
+	if a, ok := f.file.(interface{ Abort() error }); ok {
+		return a.Abort()
+	}
+	return f.file.Close()
+}
+
+// writeChecksums writes sums in the format of sha256sum, with paths
+// relative to root so the file can be checked from there.
+func writeChecksums(name, root string, sums map[string][]byte) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, p := range slices.Sorted(maps.Keys(sums)) {
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		fmt.Fprintf(w, "%x  %s\n", sums[p], filepath.ToSlash(rel))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	red    = "31"
+	green  = "32"
+	yellow = "33"
+)
+
+// useColor reports whether f is a terminal that should get colored output.
+// Setting NO_COLOR to anything turns color off.
+func useColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// paint formats n in color if enabled and n is not zero.
+func paint(enabled bool, color string, n int) string {
+	if !enabled || n == 0 {
+		return fmt.Sprint(n)
+	}
+	return fmt.Sprintf("\x1b[%sm%d\x1b[0m", color, n)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"nfstools"
+)
+
+// combinedFile describes a single file holding the directory followed by
+// the data. Without a hint the directory is preceded by its record count,
+// a uint32 in the byte order of the records.
+type combinedFile struct {
+	enabled     bool
+	headerCount int64
+	headerBytes int64
+}
+
+// load reads the directory at the front of the file name and returns
+// where the data starts, which entry offsets are relative to.
+func (c *combinedFile) load(name string, rf recordFormat) ([]nfstools.Header, nfstools.Format, int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nfstools.FormatUnknown, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nfstools.FormatUnknown, 0, err
+	}
+	return c.read(name, f, info.Size(), rf)
+}
+
+// read is load on the size bytes of r.
+func (c *combinedFile) read(name string, r io.ReaderAt, size int64, rf recordFormat) ([]nfstools.Header, nfstools.Format, int64, error) {
+	var start int64
+	tableSize := c.headerBytes
+	if tableSize == 0 {
+		count := c.headerCount
+		if count == 0 {
+			var field [4]byte
+			if _, err := r.ReadAt(field[:], 0); err != nil {
+				return nil, nfstools.FormatUnknown, 0, fmt.Errorf("%s: reading record count: %w", name, err)
+			}
+			count, start = int64(rf.order.Uint32(field[:])), 4
+		}
+		// Checked before multiplying so a bogus count can't overflow
+		if count < 0 || count > (size-start)/12 {
+			return nil, nfstools.FormatUnknown, 0, fmt.Errorf("%s: a directory of %d records does not fit in the %d byte file", name, count, size)
+		}
+
+		format := rf.format
+		if format == nfstools.FormatUnknown {
+			format = detectCounted(name, r, start, count, size, rf.order)
+		}
+		tableSize = count * 12
+		if format == nfstools.Format2003 {
+			tableSize = count * 24
+		}
+		rf.format = format
+	}
+	if tableSize < 0 || tableSize > size-start {
+		return nil, nfstools.FormatUnknown, 0, fmt.Errorf("%s: a directory of %d bytes does not fit in the %d byte file", name, tableSize, size)
+	}
+
+	table := io.NewSectionReader(r, start, tableSize)
+	format := rf.format
+	if format == nfstools.FormatUnknown {
+		format = detectFormat(name, table, rf.order)
+	}
+	headers, format, err := nfstools.ReadHeaders(table, tableSize, format, rf.order)
+	return headers, format, start + tableSize, err
+}
+
+// detectCounted guesses the layout of the count records at start of the
+// size bytes of r. Only as many bytes as count ZDIR2002 records take are
+// looked at, since under that layout the data follows them. A ZDIR2003
+// table of count records must also fit.
+func detectCounted(name string, r io.ReaderAt, start, count, size int64, order binary.ByteOrder) nfstools.Format {
+	if count > (size-start)/24 {
+		return nfstools.Format2002
+	}
+
+	head := make([]byte, min(count*12, nfstools.SniffLen))
+	n, _ := r.ReadAt(head, start)
+	format, sure := nfstools.DetectFormat(head[:n], count*24, order)
+	if !sure {
+		fmt.Fprintf(os.Stderr, "warning: %s could hold ZDIR2002 or ZDIR2003 records, assuming %s (use -format to choose)\n", name, format)
+	}
+	return format
+}
+
+// atTotalOffsets moves every header into archive 0 at its TotalOffset, so
+// entries can be read from all the archives concatenated into one file.
+func atTotalOffsets(headers []nfstools.Header) []nfstools.Header {
+	moved := make([]nfstools.Header, len(headers))
+	for i, hdr := range headers {
+		hdr.ArchiveID, hdr.LocalOffset = 0, hdr.TotalOffset
+		moved[i] = hdr
+	}
+	return moved
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"nfstools"
+)
+
+var (
+	combined2002 = []nfstools.Header{
+		{NameHash: 0x74377293, LocalOffset: 0, TotalOffset: 0, Size: 5},
+		{NameHash: 0xDEADBEEF, LocalOffset: 1, TotalOffset: 1, Size: 6},
+		{NameHash: 0x12345678, LocalOffset: 3, TotalOffset: 3, Size: 0},
+	}
+	combined2003 = []nfstools.Header{
+		{NameHash: 0x74377293, LocalOffset: 0, TotalOffset: 0, Size: 5, Checksum: 0xC0FFEE11},
+		{NameHash: 0xDEADBEEF, LocalOffset: 1, TotalOffset: 1, Size: 6, Checksum: 0x8BADF00D},
+		{NameHash: 0x12345678, LocalOffset: 2, TotalOffset: 2, Size: 7, Checksum: 0xFEEDFACE},
+	}
+)
+
+// combinedFixture returns a combined file of headers in format, preceded
+// by their count when counted is set and followed by dataLen bytes.
+func combinedFixture(t *testing.T, headers []nfstools.Header, format nfstools.Format, counted bool, dataLen int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if counted {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(headers)))
+	}
+	for _, hdr := range headers {
+		var err error
+		if format == nfstools.Format2002 {
+			err = binary.Write(&buf, binary.LittleEndian, [3]uint32{hdr.NameHash, hdr.LocalOffset, hdr.Size})
+		} else {
+			err = binary.Write(&buf, binary.LittleEndian, hdr)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf.Write(make([]byte, dataLen))
+	return buf.Bytes()
+}
+
+func TestCombinedRead(t *testing.T) {
+	tests := []struct {
+		name          string
+		combined      combinedFile
+		data          []byte
+		format        nfstools.Format
+		want          []nfstools.Header
+		wantFormat    nfstools.Format
+		wantDataStart int64
+	}{
+		{"count prefix 2002", combinedFile{}, combinedFixture(t, combined2002, nfstools.Format2002, true, 4096), nfstools.FormatUnknown, combined2002, nfstools.Format2002, 4 + 36},
+		{"count prefix 2003", combinedFile{}, combinedFixture(t, combined2003, nfstools.Format2003, true, 4096), nfstools.FormatUnknown, combined2003, nfstools.Format2003, 4 + 72},
+		{"count prefix 2003 forced", combinedFile{}, combinedFixture(t, combined2003, nfstools.Format2003, true, 0), nfstools.Format2003, combined2003, nfstools.Format2003, 4 + 72},
+		// Too short to hold three ZDIR2003 records
+		{"count prefix short data", combinedFile{}, combinedFixture(t, combined2002, nfstools.Format2002, true, 10), nfstools.FormatUnknown, combined2002, nfstools.Format2002, 4 + 36},
+		{"header count 2002", combinedFile{headerCount: 3}, combinedFixture(t, combined2002, nfstools.Format2002, false, 4096), nfstools.FormatUnknown, combined2002, nfstools.Format2002, 36},
+		{"header count 2003", combinedFile{headerCount: 3}, combinedFixture(t, combined2003, nfstools.Format2003, false, 4096), nfstools.FormatUnknown, combined2003, nfstools.Format2003, 72},
+		{"header bytes 2002", combinedFile{headerBytes: 36}, combinedFixture(t, combined2002, nfstools.Format2002, false, 4096), nfstools.FormatUnknown, combined2002, nfstools.Format2002, 36},
+		{"header bytes 2003", combinedFile{headerBytes: 72}, combinedFixture(t, combined2003, nfstools.Format2003, false, 4096), nfstools.FormatUnknown, combined2003, nfstools.Format2003, 72},
+	}
+	for _, tt := range tests {
+		rf := recordFormat{format: tt.format, order: binary.LittleEndian}
+		headers, format, dataStart, err := tt.combined.read(tt.name, bytes.NewReader(tt.data), int64(len(tt.data)), rf)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if format != tt.wantFormat {
+			t.Errorf("%s: format %s, want %s", tt.name, format, tt.wantFormat)
+		}
+		if dataStart != tt.wantDataStart {
+			t.Errorf("%s: data starts at %d, want %d", tt.name, dataStart, tt.wantDataStart)
+		}
+		if !slices.Equal(headers, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, headers, tt.want)
+		}
+	}
+}
+
+func TestCombinedReadOversized(t *testing.T) {
+	uncounted := combinedFixture(t, combined2003, nfstools.Format2003, false, 4096)
+	tests := []struct {
+		name     string
+		combined combinedFile
+		format   nfstools.Format
+	}{
+		// The first name hash is taken for the count
+		{"missing count prefix", combinedFile{}, nfstools.FormatUnknown},
+		{"missing count prefix forced", combinedFile{}, nfstools.Format2003},
+		{"header count", combinedFile{headerCount: 1 << 40}, nfstools.FormatUnknown},
+		{"header count overflowing", combinedFile{headerCount: 1 << 62}, nfstools.Format2003},
+		{"header bytes", combinedFile{headerBytes: int64(len(uncounted)) + 1}, nfstools.FormatUnknown},
+		{"negative header count", combinedFile{headerCount: -1}, nfstools.FormatUnknown},
+		{"negative header bytes", combinedFile{headerBytes: -12}, nfstools.FormatUnknown},
+	}
+	for _, tt := range tests {
+		rf := recordFormat{format: tt.format, order: binary.LittleEndian}
+		if _, _, _, err := tt.combined.read(tt.name, bytes.NewReader(uncounted), int64(len(uncounted)), rf); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"nfstools"
+)
+
+// rangeKey identifies the bytes an entry is stored in.
+type rangeKey struct {
+	archive uint32
+	offset  int64
+	size    uint32
+}
+
+// rangeKey returns the key of hdr, or false when its range is not worth
+// tracking.
+func (x *extractor) rangeKey(hdr nfstools.Header) (rangeKey, bool) {
+	if !x.dedupe {
+		return rangeKey{}, false
+	}
+	offset, err := nfstools.ResolveOffset(hdr, x.shift)
+	if err != nil {
+		// Left for extract to report
+		return rangeKey{}, false
+	}
+	return rangeKey{hdr.ArchiveID, offset, hdr.Size}, true
+}
+
+// writtenFile is the first file written for a byte range, and the
+// SHA-256 of its contents when anything asked for one.
+type writtenFile struct {
+	path string
+	sum  []byte
+}
+
+// source returns the file already holding key, if any.
+func (x *extractor) source(key rangeKey, ok bool) (writtenFile, bool) {
+	if !ok {
+		return writtenFile{}, false
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	src, ok := x.written[key]
+	return src, ok
+}
+
+// splitRepeats separates the first entry of every byte range from later
+// entries sharing it.
+func splitRepeats(entries []entry, shift uint) (firsts, repeats []entry) {
+	seen := make(map[rangeKey]bool, len(entries))
+	for _, e := range entries {
+		offset, err := nfstools.ResolveOffset(e.hdr, shift)
+		key := rangeKey{e.hdr.ArchiveID, offset, e.hdr.Size}
+		if err == nil && seen[key] {
+			repeats = append(repeats, e)
+			continue
+		}
+		seen[key] = true
+		firsts = append(firsts, e)
+	}
+	return firsts, repeats
+}
+
+// linkOrCopy makes dst a hard link to src, copying it where links are not
+// supported. It returns the size of dst.
+func linkOrCopy(src, dst string) (int64, error) {
+	if src == dst {
+		info, err := os.Stat(dst)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return 0, err
+	}
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	if err := os.Link(src, dst); err == nil {
+		info, err := os.Stat(dst)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
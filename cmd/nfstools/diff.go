@@ -0,0 +1,126 @@
+package main
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"nfstools"
+)
+
+// archiveDiff lists the names of the entries that differ between two
+// directories.
+type archiveDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// runDiff compares the entries of two ZDIRs and their archives by name
+// hash and by the SHA-256 of their bytes.
+func runDiff(args []string) {
+	var fileLists stringList
+	fs := newFlagSet("diff")
+	shift := fs.Uint("offset-shift", nfstools.OffsetShift, "entry offsets are in units of 1<<`n` bytes")
+	fs.Var(&fileLists, "filelist", "additional file name list, may be repeated")
+	noEmbedded := fs.Bool("no-embedded", false, "ignore the bundled file name list")
+	asJSON := fs.Bool("json", false, "print the differences as JSON")
+	forceFormat := formatFlag(fs)
+	hashing := addHashFlags(fs)
+	fs.Parse(args)
+	hasher := hashing.hasher()
+
+	if fs.NArg() != 4 {
+		usageError(fs)
+	}
+	hashList, _, err := loadHashLists(fileLists, !*noEmbedded, hasher)
+	if err != nil {
+		exitWithError("Failed to load file list: %v", err)
+	}
+
+	old, err := contentHashes(fs.Arg(0), fs.Arg(1), *forceFormat, *shift)
+	if err != nil {
+		exitWithError("Failed to read %s: %v", fs.Arg(0), err)
+	}
+	cur, err := contentHashes(fs.Arg(2), fs.Arg(3), *forceFormat, *shift)
+	if err != nil {
+		exitWithError("Failed to read %s: %v", fs.Arg(2), err)
+	}
+
+	d := diffEntries(hashList, old, cur)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(d); err != nil {
+			exitWithError("Failed to write diff: %v", err)
+		}
+	} else {
+		for _, line := range []struct {
+			mark  string
+			names []string
+		}{{"+", d.Added}, {"-", d.Removed}, {"M", d.Changed}} {
+			for _, name := range line.names {
+				fmt.Println(line.mark, name)
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d added, %d removed, %d changed\n", len(d.Added), len(d.Removed), len(d.Changed))
+}
+
+// diffEntries sorts the hashes of old and cur into added, removed and
+// changed entries, each sorted by name.
+func diffEntries(hashList nfstools.HashList, old, cur map[uint32][sha256.Size]byte) archiveDiff {
+	d := archiveDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	for hash, sum := range cur {
+		oldSum, ok := old[hash]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, entryName(hashList, nfstools.Header{NameHash: hash}))
+		case oldSum != sum:
+			d.Changed = append(d.Changed, entryName(hashList, nfstools.Header{NameHash: hash}))
+		}
+	}
+	for hash := range old {
+		if _, ok := cur[hash]; !ok {
+			d.Removed = append(d.Removed, entryName(hashList, nfstools.Header{NameHash: hash}))
+		}
+	}
+	for _, names := range [][]string{d.Added, d.Removed, d.Changed} {
+		slices.SortFunc(names, cmp.Compare)
+	}
+	return d
+}
+
+// contentHashes returns the SHA-256 of every entry of the ZDIR at zdir, read
+// from the archives named by archivePath.
+func contentHashes(zdir, archivePath string, rf recordFormat, shift uint) (map[uint32][sha256.Size]byte, error) {
+	headers, _, err := loadHeaders(zdir, rf)
+	if err != nil {
+		return nil, err
+	}
+	archives, err := openArchives([]string{archivePath})
+	if err != nil {
+		return nil, err
+	}
+	defer closeArchives(archives)
+
+	sums := make(map[uint32][sha256.Size]byte, len(headers))
+	for _, hdr := range headers {
+		if uint(hdr.ArchiveID) >= uint(len(archives)) {
+			return nil, fmt.Errorf("entry %08X: %w", hdr.NameHash, nfstools.ErrArchiveIndexOutOfRange)
+		}
+		offset, err := nfstools.ResolveOffset(hdr, shift)
+		if err != nil {
+			return nil, err
+		}
+		h := sha256.New()
+		if _, err := nfstools.ExtractTo(h, archives[hdr.ArchiveID], offset, int64(hdr.Size), nfstools.CopyOptions{}); err != nil {
+			return nil, fmt.Errorf("entry %08X: %w", hdr.NameHash, err)
+		}
+		sums[hdr.NameHash] = [sha256.Size]byte(h.Sum(nil))
+	}
+	return sums, nil
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"nfstools"
+)
+
+type verbosity int
+
+const (
+	quiet verbosity = iota - 1
+	normal
+	verbose
+)
+
+// extractor holds what is shared by every entry of one extraction run.
+type extractor struct {
+	archives     []io.ReaderAt
+	format       nfstools.Format
+	shift        uint
+	strict       bool
+	skipExisting bool
+	guessExt     bool
+	verbosity    verbosity
+	progress     bool
+	decompress   bool
+	keepGoing    bool
+	dedupe       bool
+	discard      bool // read entries but write nothing
+	bufferSize   int
+	failOnEmpty  bool
+	retries      int  // further attempts for entries failing with transient errors
+	convert      bool // run entries through nfstools.Converters
+
+	// mu guards stats, written, checksums, digests, held and state, and
+	// keeps output lines from different workers apart
+	mu        sync.Mutex
+	stats     runStats
+	written   map[rangeKey]writtenFile // first file holding each range when deduplicating
+	checksums map[string][]byte        // SHA-256 of every file written, when not nil
+	digests   map[int][]byte           // SHA-256 of every entry by index, when not nil
+	held      map[int]string           // line printed for every entry by index, until printHeld when not nil
+	state     *runState                // entries written by earlier runs, when resuming
+}
+
+// runStats counts what happened during a run.
+type runStats struct {
+	extracted int
+	unknown   int
+	skipped   int
+	failed    int
+	empty     int
+	bytes     int64
+	stored    int64
+}
+
+func (s runStats) done() int {
+	return s.extracted + s.skipped + s.failed
+}
+
+// print writes a one line summary, coloring the counts worth a look when
+// color is set.
+func (s runStats) print(w io.Writer, elapsed time.Duration, color bool) {
+	fmt.Fprintf(w, "%s extracted (%s unknown, %d empty), %d skipped, %s failed, %d bytes (%d stored) in %v\n",
+		paint(color, green, s.extracted), paint(color, yellow, s.unknown), s.empty, s.skipped,
+		paint(color, red, s.failed), s.bytes, s.stored, elapsed.Round(time.Millisecond))
+}
+
+// run extracts entries using the given number of workers and
+// reports whether every entry succeeded. Unless keepGoing is set it stops
+// handing out entries after the first failure. When deduplicating, entries
+// repeating an earlier byte range are linked to its file. Once ctx is done
+// no further entries are started.
+func (x *extractor) run(ctx context.Context, entries []entry, workers int) bool {
+	if x.progress && x.verbosity > quiet {
+		stop := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			x.reportProgress(len(entries), stop)
+			close(stopped)
+		}()
+		defer func() {
+			close(stop)
+			<-stopped
+		}()
+	}
+
+	if !x.dedupe {
+		x.runPool(ctx, entries, workers)
+		return x.stats.failed == 0
+	}
+
+	// Repeats are only linked once every first copy has been written
+	firsts, repeats := splitRepeats(entries, x.shift)
+	x.written = make(map[rangeKey]writtenFile)
+	x.runPool(ctx, firsts, workers)
+	x.runPool(ctx, repeats, workers)
+	return x.stats.failed == 0
+}
+
+// runPool hands entries to workers until they are done, ctx is, or,
+// unless keepGoing is set, one of them has failed.
+func (x *extractor) runPool(ctx context.Context, entries []entry, workers int) {
+	var wg sync.WaitGroup
+	jobs := make(chan entry)
+	for range max(workers, 1) {
+		wg.Go(func() {
+			for e := range jobs {
+				x.handle(ctx, e)
+			}
+		})
+	}
+
+	for _, e := range entries {
+		x.mu.Lock()
+		stop := x.stats.failed > 0 && !x.keepGoing
+		x.mu.Unlock()
+		if stop || ctx.Err() != nil {
+			break
+		}
+		jobs <- e
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// handle extracts a single entry and records the outcome.
+func (x *extractor) handle(ctx context.Context, e entry) {
+	hdr, outPath := e.hdr, e.outPath
+	if !e.known && x.guessExt {
+		outPath += x.peekExt(hdr)
+	}
+	if x.skipExisting && isExtracted(outPath, hdr) || x.state != nil && x.completedBefore(e) {
+		x.skip(ctx, e, outPath)
+		return
+	}
+
+	var n int64
+	var err error
+	var sum hash.Hash
+	if x.checksums != nil || x.digests != nil {
+		sum = sha256.New()
+	}
+	key, dedupe := x.rangeKey(hdr)
+	src, linked := x.source(key, dedupe)
+	switch {
+	case hdr.Size == 0 && x.failOnEmpty:
+		err = fmt.Errorf("entry %08X is empty", hdr.NameHash)
+	case x.discard:
+		n, err = x.extract(ctx, hdr, "", io.Discard, sum)
+	case linked:
+		n, err = linkOrCopy(src.path, outPath)
+	default:
+		n, err = x.extract(ctx, hdr, outPath, nil, sum)
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.verbosity > quiet {
+		x.print(e, outPath)
+	}
+	if x.verbosity >= verbose {
+		offset, _ := nfstools.ResolveOffset(hdr, x.shift)
+		fmt.Fprintf(os.Stderr, "  hash %08X archive %d offset %d size %d\n", hdr.NameHash, hdr.ArchiveID, offset, hdr.Size)
+		if linked {
+			fmt.Fprintf(os.Stderr, "  linked to %s\n", src.path)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		x.stats.failed++
+		return
+	}
+
+	x.stats.extracted++
+	x.stats.bytes += n
+	x.stats.stored += int64(hdr.Size)
+	if !e.known {
+		x.stats.unknown++
+	}
+	if hdr.Size == 0 {
+		x.stats.empty++
+	}
+	file := writtenFile{path: outPath}
+	switch {
+	case linked:
+		file.sum = src.sum
+	case sum != nil:
+		file.sum = sum.Sum(nil)
+	}
+	if dedupe && !linked {
+		x.written[key] = file
+	}
+	x.recordSum(e, file)
+	if x.state != nil {
+		if err := x.state.record(e); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: saving state: %v\n", err)
+		}
+	}
+}
+
+// skip records that e was left alone. Entries skipped this way are still
+// read for the summary hash, which covers every entry.
+func (x *extractor) skip(ctx context.Context, e entry, outPath string) {
+	var err error
+	var sum hash.Hash
+	if x.digests != nil {
+		sum = sha256.New()
+		_, err = x.extract(ctx, e.hdr, "", sum, nil)
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		x.stats.failed++
+		return
+	}
+	x.stats.skipped++
+	if x.verbosity > quiet {
+		x.print(e, "skipped "+outPath)
+	}
+	if sum != nil {
+		x.digests[e.index] = sum.Sum(nil)
+	}
+}
+
+// recordSum keeps the SHA-256 of a file written for e where it was asked
+// for. The caller holds mu.
+func (x *extractor) recordSum(e entry, file writtenFile) {
+	if x.checksums != nil {
+		x.checksums[file.path] = file.sum
+	}
+	if x.digests != nil {
+		x.digests[e.index] = file.sum
+	}
+}
+
+// print writes the line reporting e, or holds it back for printHeld.
+// The caller holds mu.
+func (x *extractor) print(e entry, line string) {
+	if x.held != nil {
+		x.held[e.index] = line
+		return
+	}
+	fmt.Println(line)
+}
+
+// printHeld writes the lines held back by print in directory order.
+func (x *extractor) printHeld() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, i := range slices.Sorted(maps.Keys(x.held)) {
+		fmt.Println(x.held[i])
+	}
+	clear(x.held)
+}
+
+func (x *extractor) completedBefore(e entry) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.state.completed(e)
+}
+
+// reportProgress redraws a progress line on stderr until stop is closed.
+func (x *extractor) reportProgress(total int, stop <-chan struct{}) {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	draw := func() {
+		x.mu.Lock()
+		s := x.stats
+		x.mu.Unlock()
+		fmt.Fprintf(os.Stderr, "\r%d/%d entries, %d bytes", s.done(), total, s.bytes)
+	}
+	for {
+		select {
+		case <-ticker.C:
+			draw()
+		case <-stop:
+			draw()
+			fmt.Fprintln(os.Stderr)
+			return
+		}
+	}
+}
+
+// extract writes a single entry to outPath, or to w when it is not nil,
+// verifying its checksum when the directory carries one. Unless it is nil,
+// sum is fed the bytes written. It returns the number of bytes written.
+// Once ctx is done failed entries are no longer retried.
+func (x *extractor) extract(ctx context.Context, hdr nfstools.Header, outPath string, w io.Writer, sum hash.Hash) (int64, error) {
+	if uint(hdr.ArchiveID) >= uint(len(x.archives)) {
+		return 0, fmt.Errorf("entry %08X: %w: references archive %d but only %d given", hdr.NameHash, nfstools.ErrArchiveIndexOutOfRange, hdr.ArchiveID, len(x.archives))
+	}
+
+	opts := nfstools.CopyOptions{Decompress: x.decompress, BufferSize: x.bufferSize}
+	if x.format == nfstools.Format2003 {
+		opts.Sum = nfstools.NewChecksum()
+		// Checked before the file is closed, so a strict mismatch
+		// never reaches outPath
+		opts.Check = func() error {
+			if opts.Sum.Sum32() == hdr.Checksum {
+				return nil
+			}
+			err := fmt.Errorf("entry %08X: %w (stored %08X, computed %08X)", hdr.NameHash, nfstools.ErrChecksumMismatch, hdr.Checksum, opts.Sum.Sum32())
+			if x.strict {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			return nil
+		}
+	}
+
+	offset, err := nfstools.ResolveOffset(hdr, x.shift)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	for attempt := 0; ; attempt++ {
+		if opts.Sum != nil {
+			opts.Sum.Reset()
+		}
+		if sum != nil {
+			sum.Reset()
+		}
+		n, err = x.copyOut(hdr, outPath, w, sum, offset, opts)
+		// Retrying is only safe while nothing reached w
+		if err == nil || attempt >= x.retries || !isTransient(err) || w != nil && n > 0 {
+			break
+		}
+		delay := min(retryDelay<<min(attempt, 16), maxRetryDelay)
+		if x.verbosity > quiet {
+			fmt.Fprintf(os.Stderr, "warning: %v, retrying in %v\n", err, delay)
+		}
+		if !wait(ctx, delay) {
+			break
+		}
+	}
+	return n, err
+}
+
+// copyOut copies the entry at offset to w, or to outPath when w is nil,
+// feeding sum along the way when it is not nil.
+func (x *extractor) copyOut(hdr nfstools.Header, outPath string, w io.Writer, sum hash.Hash, offset int64, opts nfstools.CopyOptions) (int64, error) {
+	archive := x.archives[hdr.ArchiveID]
+	if w != nil {
+		if sum != nil {
+			w = io.MultiWriter(w, sum)
+		}
+		return nfstools.ExtractTo(w, archive, offset, int64(hdr.Size), opts)
+	}
+
+	var sink nfstools.OutputSink = nfstools.DiskSink{}
+	if sum != nil {
+		// Hash while copying rather than reading the file back
+		sink = hashingSink{sum}
+	}
+	if convert := x.converter(archive, offset, int64(hdr.Size)); convert != nil {
+		return convertEntry(sink, convert, archive, outPath, offset, int64(hdr.Size), opts)
+	}
+	return nfstools.ExtractToSink(sink, archive, outPath, offset, int64(hdr.Size), opts)
+}
+
+// converter returns the converter registered for the type of the entry at
+// offset, if converting.
+func (x *extractor) converter(archive io.ReaderAt, offset, size int64) nfstools.Converter {
+	if !x.convert {
+		return nil
+	}
+	return nfstools.Converters[nfstools.PeekExt(archive, offset, size)]
+}
+
+// convertEntry writes the entry at offset to outPath through convert and
+// returns the number of bytes convert wrote.
+func convertEntry(sink nfstools.OutputSink, convert nfstools.Converter, archive io.ReaderAt, outPath string, offset, size int64, opts nfstools.CopyOptions) (int64, error) {
+	out, err := sink.Create(outPath)
+	if err != nil {
+		return 0, err
+	}
+
+	pr, pw := io.Pipe()
+	extracted := make(chan error, 1)
+	go func() {
+		_, err := nfstools.ExtractTo(pw, archive, offset, size, opts)
+		pw.CloseWithError(err)
+		extracted <- err
+	}()
+
+	counter := &countingWriter{w: out}
+	err = convert(pr, counter)
+	// Read what convert left so the whole entry is checked
+	if _, drainErr := io.Copy(io.Discard, pr); err == nil {
+		err = drainErr
+	}
+	if extractErr := <-extracted; err == nil {
+		err = extractErr
+	}
+	if err != nil {
+		if a, ok := out.(interface{ Abort() error }); ok {
+			a.Abort()
+		} else {
+			out.Close()
+		}
+		return counter.n, fmt.Errorf("%s: %w", outPath, err)
+	}
+	if err := out.Close(); err != nil {
+		return counter.n, fmt.Errorf("%s: %w", outPath, err)
+	}
+	return counter.n, nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// retryDelay is how long the first retry of a failed entry waits. Every
+// further retry waits twice as long as the one before, up to
+// maxRetryDelay.
+const (
+	retryDelay    = 100 * time.Millisecond
+	maxRetryDelay = 5 * time.Second
+)
+
+// wait sleeps for d and reports whether it did so before ctx was done.
+func wait(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// isTransient reports whether err is a read error that may go away when
+// tried again, as seen on network file systems. Truncated archives, bad
+// ranges and corrupt data are not.
+func isTransient(err error) bool {
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return false
+	}
+	var temporary interface{ Temporary() bool }
+	if errors.As(err, &temporary) && temporary.Temporary() {
+		return true
+	}
+	return errors.Is(err, syscall.EIO) || errors.Is(err, syscall.ESTALE) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// peekExt guesses the extension of an entry from its first bytes.
+func (x *extractor) peekExt(hdr nfstools.Header) string {
+	offset, err := nfstools.ResolveOffset(hdr, x.shift)
+	if err != nil || uint(hdr.ArchiveID) >= uint(len(x.archives)) {
+		// Left for extract to report
+		return ""
+	}
+	return nfstools.PeekExt(x.archives[hdr.ArchiveID], offset, int64(hdr.Size))
+}
+
+// isExtracted reports whether outPath already holds a file of the size
+// recorded in hdr.
+func isExtracted(outPath string, hdr nfstools.Header) bool {
+	info, err := os.Stat(outPath)
+	return err == nil && info.Mode().IsRegular() && info.Size() == int64(hdr.Size)
+}
+
+// byOffset returns a copy of entries sorted by where they are stored, so
+// each archive is read front to back.
+func byOffset(entries []entry) []entry {
+	sorted := slices.Clone(entries)
+	slices.SortStableFunc(sorted, compareOffsets)
+	return sorted
+}
+
+func compareOffsets(a, b entry) int {
+	return cmp.Or(cmp.Compare(a.hdr.ArchiveID, b.hdr.ArchiveID), cmp.Compare(a.hdr.LocalOffset, b.hdr.LocalOffset))
+}
+
+// firstEntries keeps the first n entries, or with sorted the n stored
+// first, in directory order.
+func firstEntries(entries []entry, n int, sorted bool) []entry {
+	if n >= len(entries) {
+		return entries
+	}
+	if !sorted {
+		return entries[:n]
+	}
+
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return compareOffsets(entries[a], entries[b])
+	})
+	order = order[:n]
+	slices.Sort(order)
+
+	kept := make([]entry, n)
+	for i, j := range order {
+		kept[i] = entries[j]
+	}
+	return kept
+}
+
+// foldDigests returns the summary hash, the SHA-256 over the SHA-256 of
+// every entry in directory order.
+func foldDigests(digests map[int][]byte) []byte {
+	h := sha256.New()
+	for _, i := range slices.Sorted(maps.Keys(digests)) {
+		h.Write(digests[i])
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"nfstools"
+)
+
+func TestExtractChecksum(t *testing.T) {
+	data := []byte("entry data")
+	sum := nfstools.NewChecksum()
+	sum.Write(data)
+	good := nfstools.Header{NameHash: 1, Size: uint32(len(data)), Checksum: sum.Sum32()}
+	bad := good
+	bad.Checksum++
+
+	tests := []struct {
+		name     string
+		hdr      nfstools.Header
+		strict   bool
+		wantErr  bool
+		wantFile bool
+	}{
+		{"matching", good, true, false, true},
+		{"mismatch", bad, false, false, true},
+		{"strict mismatch", bad, true, true, false},
+	}
+	for _, tt := range tests {
+		x := &extractor{
+			archives:  []io.ReaderAt{bytes.NewReader(data)},
+			format:    nfstools.Format2003,
+			shift:     nfstools.OffsetShift,
+			strict:    tt.strict,
+			verbosity: quiet,
+		}
+		dir := t.TempDir()
+		outPath := filepath.Join(dir, "CARS", "BIG.BIN")
+		_, err := x.extract(context.Background(), tt.hdr, outPath, nil, nil)
+		if tt.wantErr != (err != nil) {
+			t.Errorf("%s: error %v, want error %t", tt.name, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, nfstools.ErrChecksumMismatch) {
+			t.Errorf("%s: got %v, want ErrChecksumMismatch", tt.name, err)
+		}
+		if _, err := os.Stat(outPath); tt.wantFile != (err == nil) {
+			t.Errorf("%s: stat %s: %v, want file %t", tt.name, outPath, err, tt.wantFile)
+		}
+		if !tt.wantFile {
+			left, _ := os.ReadDir(filepath.Dir(outPath))
+			if len(left) > 0 {
+				t.Errorf("%s: left %s behind", tt.name, left[0].Name())
+			}
+		}
+	}
+}
+
+// failingArchive fails every read with an error worth retrying.
+type failingArchive struct{ reads int }
+
+func (a *failingArchive) ReadAt(p []byte, off int64) (int, error) {
+	a.reads++
+	return 0, syscall.EIO
+}
+
+func TestExtractRetries(t *testing.T) {
+	archive := &failingArchive{}
+	x := &extractor{archives: []io.ReaderAt{archive}, retries: 2, verbosity: quiet}
+	_, err := x.extract(context.Background(), nfstools.Header{Size: 4}, "", io.Discard, nil)
+	if !errors.Is(err, syscall.EIO) {
+		t.Errorf("got %v, want EIO", err)
+	}
+	if archive.reads != 3 {
+		t.Errorf("read %d times, want 3", archive.reads)
+	}
+}
+
+// TestExtractRetriesInterrupted makes sure a done context isn't stuck
+// behind the backoff of many retries.
+func TestExtractRetriesInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	archive := &failingArchive{}
+	x := &extractor{archives: []io.ReaderAt{archive}, retries: 16, verbosity: quiet}
+	start := time.Now()
+	if _, err := x.extract(ctx, nfstools.Header{Size: 4}, "", io.Discard, nil); !errors.Is(err, syscall.EIO) {
+		t.Errorf("got %v, want EIO", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took %v", elapsed)
+	}
+	if archive.reads != 1 {
+		t.Errorf("read %d times, want 1", archive.reads)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"nfstools"
+)
+
+// entryFilter selects entries by exact name or hash, by size or by glob patterns
+// matched against their resolved names. Patterns without a separator match
+// the base name only.
+type entryFilter struct {
+	names          stringList
+	hashes         hashFlag
+	include        stringList
+	exclude        stringList
+	includeUnknown bool
+	minSize        uint64
+	maxSize        uint64          // 0 means no limit
+	hasher         nfstools.Hasher // hashes names
+}
+
+// validate reports the first malformed pattern or an empty size range.
+func (f *entryFilter) validate() error {
+	if f.maxSize > 0 && f.minSize > f.maxSize {
+		return fmt.Errorf("minimum size %d is above maximum size %d", f.minSize, f.maxSize)
+	}
+	for _, pattern := range slices.Concat(f.include, f.exclude) {
+		if _, err := path.Match(toSlash(pattern), ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *entryFilter) match(name string, known bool) bool {
+	if !known {
+		// Nothing to match a pattern against
+		return f.includeUnknown || len(f.include) == 0
+	}
+
+	name = toSlash(name)
+	if len(f.include) > 0 && !matchAny(f.include, name) {
+		return false
+	}
+	return !matchAny(f.exclude, name)
+}
+
+func (f *entryFilter) apply(hashList nfstools.HashList, headers []indexedHeader) []indexedHeader {
+	if len(f.names) == 0 && len(f.hashes) == 0 && len(f.include) == 0 && len(f.exclude) == 0 && !f.includeUnknown &&
+		f.minSize == 0 && f.maxSize == 0 {
+		return headers
+	}
+
+	var wanted map[uint32]bool
+	if len(f.names) > 0 || len(f.hashes) > 0 {
+		wanted = make(map[uint32]bool, len(f.names)+len(f.hashes))
+		for _, name := range f.names {
+			wanted[f.hasher.Hash(name)] = true
+		}
+		for _, hash := range f.hashes {
+			wanted[hash] = true
+		}
+	}
+
+	filtered := make([]indexedHeader, 0, len(headers))
+	for _, hdr := range headers {
+		if wanted != nil && !wanted[hdr.NameHash] {
+			continue
+		}
+		if uint64(hdr.Size) < f.minSize || f.maxSize > 0 && uint64(hdr.Size) > f.maxSize {
+			continue
+		}
+		name, known := hashList[hdr.NameHash]
+		if f.match(name, known) {
+			filtered = append(filtered, hdr)
+		}
+	}
+	return filtered
+}
+
+// readNames adds every line of the file at name to the names to extract,
+// skipping blank lines and lines starting with #.
+func (f *entryFilter) readNames(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			f.names = append(f.names, line)
+		}
+	}
+	return scanner.Err()
+}
+
+// missingNames returns the requested names no header carries the hash of.
+func (f *entryFilter) missingNames(headers []indexedHeader) []string {
+	present := make(map[uint32]bool, len(headers))
+	for _, hdr := range headers {
+		present[hdr.NameHash] = true
+	}
+
+	var missing []string
+	for _, name := range f.names {
+		if !present[f.hasher.Hash(name)] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		pattern = toSlash(pattern)
+		target := name
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(name)
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// toSlash converts the game's backslash separators to forward slashes.
+func toSlash(name string) string {
+	return strings.ReplaceAll(name, `\`, "/")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// stringList collects every value of a repeatable flag.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// hashFlag collects the name hashes given to a repeatable flag.
+type hashFlag []uint32
+
+func (h *hashFlag) String() string {
+	hashes := make([]string, len(*h))
+	for i, hash := range *h {
+		hashes[i] = fmt.Sprintf("%08X", hash)
+	}
+	return strings.Join(hashes, ",")
+}
+
+func (h *hashFlag) Set(value string) error {
+	hash, err := parseHash(value)
+	if err != nil {
+		return err
+	}
+	*h = append(*h, hash)
+	return nil
+}
+
+// parseHash parses a hexadecimal name hash with an optional 0x prefix.
+func parseHash(s string) (uint32, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	hash, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hash %q", s)
+	}
+	return uint32(hash), nil
+}
+
+// indexRange is a START:END flag selecting directory indices like a slice
+// expression. Either bound may be left out.
+type indexRange struct {
+	start, end int // end is -1 when open
+	set        bool
+}
+
+func (r *indexRange) String() string {
+	if !r.set {
+		return ""
+	}
+	if r.end < 0 {
+		return fmt.Sprintf("%d:", r.start)
+	}
+	return fmt.Sprintf("%d:%d", r.start, r.end)
+}
+
+func (r *indexRange) Set(value string) error {
+	startText, endText, ok := strings.Cut(value, ":")
+	if !ok {
+		return errors.New("want START:END")
+	}
+
+	start, end := 0, -1
+	var err error
+	if startText != "" {
+		if start, err = strconv.Atoi(startText); err != nil || start < 0 {
+			return fmt.Errorf("invalid start %q", startText)
+		}
+	}
+	if endText != "" {
+		if end, err = strconv.Atoi(endText); err != nil || end < start {
+			return fmt.Errorf("invalid end %q", endText)
+		}
+	}
+	*r = indexRange{start: start, end: end, set: true}
+	return nil
+}
+
+// slice returns the selected part of headers.
+func (r *indexRange) slice(headers []indexedHeader) ([]indexedHeader, error) {
+	if !r.set {
+		return headers, nil
+	}
+	end := r.end
+	if end < 0 {
+		end = len(headers)
+	}
+	if r.start > len(headers) || end > len(headers) {
+		return nil, fmt.Errorf("range %s is outside the %d entries", r, len(headers))
+	}
+	return headers[r.start:end], nil
+}
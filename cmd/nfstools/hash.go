@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"nfstools"
+)
+
+// runHash prints the hash of every name given on the command line, or of
+// every line read from stdin when there are none. With -from-dir it hashes
+// the path of every file below a directory instead.
+func runHash(args []string) {
+	fs := newFlagSet("hash")
+	hashing := addHashFlags(fs)
+	fromDir := fs.String("from-dir", "", "print a name = hash line for every file below `dir`")
+	fs.Parse(args)
+	hasher := hashing.hasher()
+
+	if *fromDir != "" {
+		if fs.NArg() > 0 {
+			usageError(fs)
+		}
+		if err := hashDir(os.Stdout, *fromDir, hasher); err != nil {
+			exitWithError("Failed to hash %s: %v", *fromDir, err)
+		}
+		return
+	}
+
+	if fs.NArg() > 0 {
+		for _, name := range fs.Args() {
+			printHash(os.Stdout, hasher, name)
+		}
+		return
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		printHash(os.Stdout, hasher, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		exitWithError("Failed to read names: %v", err)
+	}
+}
+
+func printHash(w io.Writer, hasher nfstools.Hasher, name string) {
+	hash := hasher.Hash(name)
+	fmt.Fprintf(w, "%08X\t%d\t%s\n", hash, hash, name)
+}
+
+// hashDir prints the game style name of every regular file below root,
+// relative to it, together with its hash.
+func hashDir(w io.Writer, root string, hasher nfstools.Hasher) error {
+	bw := bufio.NewWriter(w)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := strings.ReplaceAll(filepath.ToSlash(rel), "/", `\`)
+		fmt.Fprintf(bw, "%s = %08X\n", name, hasher.Hash(name))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"nfstools"
+)
+
+// hashAlgos are the known name hash variants. Only nfs has been seen in
+// the games so far.
+var hashAlgos = map[string]nfstools.Hasher{
+	"nfs":   {Seed: nfstools.DefaultSeed, Op: nfstools.HashAdd},
+	"djb2":  {Seed: 5381, Op: nfstools.HashAdd},
+	"djb2a": {Seed: 5381, Op: nfstools.HashXor},
+}
+
+// hashFlags selects the hasher used for file names. -hash-seed and
+// -hash-op override the variant picked by -hash-algo whatever their order.
+type hashFlags struct {
+	raw  bool
+	algo nfstools.Hasher
+	seed *uint32
+	op   *nfstools.HashOp
+}
+
+// addHashFlags registers the hashing flags on fs. The hasher they select is
+// returned by hasher once fs is parsed.
+func addHashFlags(fs *flag.FlagSet) *hashFlags {
+	h := &hashFlags{algo: nfstools.DefaultHasher}
+	names := strings.Join(slices.Sorted(maps.Keys(hashAlgos)), ", ")
+	fs.BoolVar(&h.raw, "raw-names", false, "hash names byte for byte without normalizing them")
+	fs.Func("hash-algo", "hash names with the `variant` "+names+" (default nfs)", func(s string) error {
+		hasher, ok := hashAlgos[s]
+		if !ok {
+			return fmt.Errorf("want one of %s", names)
+		}
+		h.algo = hasher
+		return nil
+	})
+	fs.Func("hash-seed", "start hashing names from `value` instead of the variant's seed", func(s string) error {
+		seed, err := strconv.ParseUint(s, 0, 32)
+		if err != nil {
+			return fmt.Errorf("invalid seed %q", s)
+		}
+		value := uint32(seed)
+		h.seed = &value
+		return nil
+	})
+	fs.Func("hash-op", "fold in each byte with `op` add or xor instead of the variant's", func(s string) error {
+		var op nfstools.HashOp
+		switch s {
+		case "add":
+			op = nfstools.HashAdd
+		case "xor":
+			op = nfstools.HashXor
+		default:
+			return fmt.Errorf("want add or xor")
+		}
+		h.op = &op
+		return nil
+	})
+	return h
+}
+
+// hasher returns the hasher selected by the flags.
+func (h *hashFlags) hasher() nfstools.Hasher {
+	hasher := h.algo
+	hasher.Raw = h.raw
+	if h.seed != nil {
+		hasher.Seed = *h.seed
+	}
+	if h.op != nil {
+		hasher.Op = *h.op
+	}
+	return hasher
+}
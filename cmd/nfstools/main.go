@@ -0,0 +1,771 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"nfstools"
+)
+
+// Exit codes, so scripts can tell failures apart.
+const (
+	exitError       = 1   // anything not covered below
+	exitUsage       = 2   // bad command line, as used by the flag package
+	exitNoZDIR      = 3   // the ZDIR could not be read
+	exitEntryFailed = 4   // one or more entries could not be extracted
+	exitInterrupted = 130 // stopped by SIGINT, as shells report it
+)
+
+// command is a subcommand besides extract, which runs when no subcommand
+// is named.
+type command struct {
+	name, synopsis string
+	run            func(args []string)
+}
+
+var commands []command
+
+func init() {
+	// Set here as the commands refer back to the table for their usage
+	commands = []command{
+		{"verify", "[options] <ZDIR>", runVerify},
+		{"checksum", "[options] <ZDIR> <ZZDATA{0..3}>", runChecksum},
+		{"pack", "[options] <DIR> <ZDIR> <ZZDATA>", runPack},
+		{"hash", "[options] [NAME...]", runHash},
+		{"recover", "[options] <ZDIR> <WORDLIST>", runRecover},
+		{"diff", "[options] <OLD ZDIR> <OLD ZZDATA{0..3}> <NEW ZDIR> <NEW ZZDATA{0..3}>", runDiff},
+		{"selftest", "[options]", runSelftest},
+	}
+}
+
+func main() {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		for _, cmd := range commands {
+			if args[0] == cmd.name {
+				cmd.run(args[1:])
+				return
+			}
+		}
+		switch args[0] {
+		case "help":
+			flag.CommandLine.SetOutput(os.Stdout)
+			printUsage()
+			return
+		case "extract":
+			args = args[1:]
+		}
+	}
+
+	var list bool
+	var paths layout
+	var fileLists stringList
+	var filter entryFilter
+	var indices indexRange
+	var combined combinedFile
+	dryRun := flag.Bool("dry-run", false, "report what would be written without extracting")
+	countOnly := flag.Bool("count-only", false, "print the number of entries and the ZDIR format, then exit")
+	strict := flag.Bool("strict", false, "fail on checksum mismatch")
+	workers := flag.Int("j", runtime.GOMAXPROCS(0), "number of concurrent extractions")
+	flag.BoolVar(&list, "l", false, "shorthand for -list")
+	flag.BoolVar(&list, "list", false, "list entries without extracting")
+	flag.StringVar(&paths.Root, "o", nfstools.ExtractedRoot, "shorthand for -output")
+	flag.StringVar(&paths.Root, "output", nfstools.ExtractedRoot, "directory to extract into")
+	flag.StringVar(&paths.Prefix, "prefix", "", "extract every entry below `dir` inside the output directory")
+	flag.BoolVar(&paths.byArchive, "group-by-archive", false, "extract the entries of each archive below archiveN")
+	flag.StringVar(&paths.UnknownDir, "unknown-dir", nfstools.UnknownDir, "directory below the output for entries without a known `name`")
+	flag.BoolVar(&paths.skipUnknown, "skip-unknown", false, "do not extract entries without a known name")
+	flag.BoolVar(&paths.caseSafe, "case-safe", false, "rename entries whose paths differ only by case")
+	flag.BoolVar(&paths.Flatten, "flatten", false, "extract known files without their directories")
+	flag.BoolVar(&paths.Lower, "lower", false, "lowercase known names")
+	flag.UintVar(&paths.StripComponents, "strip-components", 0, "drop the first `n` components of known names")
+	flag.Var(&fileLists, "filelist", "additional file name list, may be repeated")
+	renameMap := flag.String("rename-map", "", "name entries after the hash<TAB>path lines of `file`, over any file list")
+	noEmbedded := flag.Bool("no-embedded", false, "ignore the bundled file name list")
+	warnCollisions := flag.Bool("warn-collisions", false, "report file names that share a hash")
+	failOnCollision := flag.Bool("fail-on-collision", false, "stop before extracting if entries share an output path")
+	checkOverlap := flag.Bool("check-overlaps", false, "report entries whose bytes overlap")
+	verifyNames := flag.Bool("verify-names", false, "check that every known name hashes back to its entry")
+	manifestPath := flag.String("manifest", "", "write a manifest of every selected entry to `file`")
+	manifestFormat := flag.String("manifest-format", "json", "write the -manifest as json or csv")
+	manifestFilter := flag.String("manifest-filter", "all", "write only the known, the unknown or all entries to the -manifest")
+	combinedData := flag.String("combined-data", "", "read ZDIR2003 entries from `file`, the archives concatenated in order, by their total offset")
+	flag.BoolVar(&combined.enabled, "combined", false, "read the directory from the front of a single file holding the data too")
+	flag.Int64Var(&combined.headerCount, "header-count", 0, "the -combined directory holds `n` records")
+	flag.Int64Var(&combined.headerBytes, "header-bytes", 0, "the -combined directory is `n` bytes long")
+	fromManifest := flag.String("from-manifest", "", "take the entries from the manifest `file` instead of a ZDIR")
+	onlyNew := flag.String("only-new", "", "only extract entries added or changed since the manifest `file`")
+	requireKnown := flag.Bool("require-known", false, "fail without extracting if any selected entry has no known name")
+	dumpUnknown := flag.String("dump-unknown", "", "write the hash of every unknown entry to `file`")
+	jsonList := flag.Bool("json", false, "print the -list output as JSON")
+	flag.Var(&filter.include, "include", "only extract entries matching `pattern`, may be repeated")
+	flag.Var(&filter.exclude, "exclude", "skip entries matching `pattern`, may be repeated")
+	flag.BoolVar(&filter.includeUnknown, "include-unknown", false, "extract unknown entries despite -include")
+	flag.Var(&filter.names, "name", "only extract the entry called `name`, may be repeated")
+	namesFile := flag.String("names-file", "", "only extract the entries named on the lines of `file`")
+	flag.Var(&filter.hashes, "hash", "only extract the entry with the name hash `hex`, may be repeated")
+	flag.Var(&indices, "range", "only extract the entries at directory indices `START:END`")
+	flag.Uint64Var(&filter.minSize, "min-size", 0, "skip entries smaller than `bytes`")
+	flag.Uint64Var(&filter.maxSize, "max-size", 0, "skip entries larger than `bytes`")
+	toStdout := flag.Bool("stdout", false, "write the single selected entry to stdout")
+	toZip := flag.String("to-zip", "", "write every entry into the zip archive `file` instead of a directory")
+	toTar := flag.String("to-tar", "", "write every entry into the tar archive `file` instead of a directory")
+	statePath := flag.String("state", "", "record written entries in `file` and skip those it lists, to resume a run")
+	skipExisting := flag.Bool("skip-existing", false, "skip entries already extracted with the right size")
+	bufferSize := flag.Int("buffer-size", 0, "copy entries through a buffer of `bytes`, 0 sizes it per entry")
+	discard := flag.Bool("null", false, "read every entry but discard the data, for benchmarking")
+	limit := flag.Int("limit", 0, "only list, extract or write to the -manifest the first `n` selected entries, by offset with -sort-by-offset")
+	sortByOffset := flag.Bool("sort-by-offset", false, "extract, list and print entries in archive order rather than directory order")
+	directoryOrder := flag.Bool("directory-order", false, "with -sort-by-offset, still list entries and print what was extracted in directory order")
+	dedupe := flag.Bool("dedupe", false, "hard link entries stored at the same place instead of extracting them again")
+	var beQuiet, beVerbose bool
+	flag.BoolVar(&beQuiet, "q", false, "shorthand for -quiet")
+	flag.BoolVar(&beQuiet, "quiet", false, "print nothing on success")
+	flag.BoolVar(&beVerbose, "v", false, "shorthand for -verbose")
+	flag.BoolVar(&beVerbose, "verbose", false, "print details about every entry to stderr")
+	shift := flag.Uint("offset-shift", nfstools.OffsetShift, "entry offsets are in units of 1<<`N` bytes")
+	hashing := addHashFlags(flag.CommandLine)
+	flag.BoolFunc("unknown-by-offset", "name unknown entries after their offset instead of their hash", func(string) error {
+		paths.UnknownName = nfstools.NameByOffset
+		return nil
+	})
+	useMmap := flag.Bool("mmap", false, "read archives through a memory mapping")
+	decompress := flag.Bool("decompress", false, "inflate zlib compressed entries")
+	forceFormat := formatFlag(flag.CommandLine)
+	retries := flag.Int("retries", 0, "retry entries failing with transient read errors up to `n` times")
+	keepGoing := flag.Bool("keep-going", false, "carry on after an entry fails")
+	failOnEmpty := flag.Bool("fail-on-empty", false, "treat entries with a size of zero as failures")
+	progress := flag.Bool("progress", false, "show progress on stderr")
+	checksums := flag.String("checksums", "", "write the SHA-256 of every extracted file to `file`, in sha256sum format")
+	summaryHash := flag.Bool("summary-hash", false, "print a SHA-256 over the SHA-256 of every entry in directory order")
+	showStats := flag.Bool("stats", false, "print a summary to stderr when done")
+	convert := flag.Bool("convert", false, "run entries of a recognized type through the converter registered for it")
+	guessExt := flag.Bool("guess-ext", false, "append an extension guessed from the content to unknown entries")
+	flag.Usage = printUsage
+	flag.CommandLine.Parse(args)
+	hasher := hashing.hasher()
+	filter.hasher = hasher
+
+	args = flag.Args()
+	source, archivePaths := "", args
+	if *fromManifest != "" {
+		source = *fromManifest
+	} else if combined.enabled && len(args) == 1 {
+		source = args[0]
+	} else if *combinedData != "" && len(args) == 1 {
+		source, archivePaths = args[0], []string{*combinedData}
+	} else if len(args) > 0 {
+		source, archivePaths = args[0], args[1:]
+	}
+	if source == "" || len(archivePaths) == 0 && !(list || *dryRun || *countOnly || combined.enabled) {
+		usageError(flag.CommandLine)
+	}
+	if *namesFile != "" {
+		if err := filter.readNames(*namesFile); err != nil {
+			exitWithError("Failed to read names: %v", err)
+		}
+	}
+	if err := filter.validate(); err != nil {
+		exitWithError("Invalid filter: %v", err)
+	}
+	if paths.Prefix != "" && !filepath.IsLocal(paths.Prefix) {
+		exitWithError("-prefix %s must be a relative path inside the output directory", paths.Prefix)
+	}
+	if paths.UnknownDir != "" && !filepath.IsLocal(paths.UnknownDir) {
+		exitWithError("-unknown-dir %s must be a relative path inside the output directory", paths.UnknownDir)
+	}
+	if *manifestFormat != "json" && *manifestFormat != "csv" {
+		exitWithError("unknown manifest format %q", *manifestFormat)
+	}
+	if *manifestFilter != "known" && *manifestFilter != "unknown" && *manifestFilter != "all" {
+		exitWithError("unknown manifest filter %q, want known, unknown or all", *manifestFilter)
+	}
+	if *toZip != "" && *toTar != "" {
+		exitWithError("-to-zip and -to-tar cannot be combined")
+	}
+	if *retries < 0 {
+		exitWithError("-retries must not be negative")
+	}
+	if *limit < 0 {
+		exitWithError("-limit must not be negative")
+	}
+	if *combinedData != "" && (combined.enabled || *fromManifest != "") {
+		exitWithError("-combined-data cannot be used with -combined or -from-manifest")
+	}
+	if *combinedData != "" && len(args) > 1 {
+		exitWithError("-combined-data takes the place of the archives, give only the ZDIR")
+	}
+	if *checksums != "" && (*toZip != "" || *toTar != "" || *toStdout || *discard) {
+		exitWithError("-checksums needs files to be extracted to a directory")
+	}
+	if *summaryHash && *toStdout {
+		exitWithError("-summary-hash cannot be used with -stdout, which prints the data")
+	}
+
+	var headers []nfstools.Header
+	var format nfstools.Format
+	var manifestNames nfstools.HashList
+	var dataStart int64
+	var err error
+	switch {
+	case *fromManifest != "":
+		headers, manifestNames, format, err = readManifestFile(*fromManifest, *shift)
+	case combined.enabled:
+		headers, format, dataStart, err = combined.load(source, *forceFormat)
+		archivePaths = []string{source}
+	default:
+		headers, format, err = loadHeaders(source, *forceFormat)
+	}
+	if err != nil {
+		exitWith(exitNoZDIR, "Failed to load headers: %v", err)
+	}
+	if *combinedData != "" {
+		if format != nfstools.Format2003 {
+			exitWithError("-combined-data needs a ZDIR2003 directory, %s is ZDIR%s", source, format)
+		}
+		headers = atTotalOffsets(headers)
+	}
+	if *countOnly {
+		fmt.Printf("%d entries, ZDIR%s\n", len(headers), format)
+		return
+	}
+	if len(headers) == 0 {
+		fmt.Fprintf(os.Stderr, "%s: directory has no entries, nothing to do\n", source)
+		return
+	}
+
+	hashList, collisions, err := loadHashLists(fileLists, !*noEmbedded, hasher)
+	if err != nil {
+		exitWithError("Failed to load file list: %v", err)
+	}
+	hashList.Merge(manifestNames)
+	if *renameMap != "" {
+		if paths.renames, err = readRenameMap(*renameMap); err != nil {
+			exitWithError("Failed to load rename map: %v", err)
+		}
+	}
+	if *warnCollisions {
+		for _, c := range collisions {
+			fmt.Fprintf(os.Stderr, "warning: %q and %q share hash %08X\n", c.Existing, c.Name, c.Hash)
+		}
+	}
+
+	selected, err := indices.slice(numbered(headers))
+	if err != nil {
+		exitWithError("Invalid range: %v", err)
+	}
+	for _, name := range filter.missingNames(selected) {
+		fmt.Fprintf(os.Stderr, "warning: %s is not in %s\n", name, source)
+	}
+	selected = filter.apply(hashList, selected)
+	if *onlyNew != "" {
+		previous, _, _, err := readManifestFile(*onlyNew, *shift)
+		if err != nil {
+			exitWithError("Failed to read manifest: %v", err)
+		}
+		selected = changedSince(previous, selected)
+	}
+	if *verifyNames {
+		checkNames(os.Stderr, hasher, hashList, selected)
+	}
+	if *checkOverlap {
+		n := checkOverlaps(os.Stderr, hashList, selected, *shift)
+		fmt.Fprintf(os.Stderr, "%d overlapping entries\n", n)
+	}
+	others := otherNames(hasher, hashList, collisions)
+
+	if *dumpUnknown != "" {
+		if err := writeUnknownHashes(*dumpUnknown, hashList, selected); err != nil {
+			exitWithError("Failed to write unknown hashes: %v", err)
+		}
+	}
+	if *requireKnown {
+		unknown := 0
+		for _, hdr := range selected {
+			if _, known := hashList.Name(hdr.NameHash); !known {
+				unknown++
+			}
+		}
+		if unknown > 0 {
+			exitWithError("%d of %d entries have no known name", unknown, len(selected))
+		}
+	}
+
+	entries := paths.plan(hashList, selected)
+	if *limit > 0 {
+		entries = firstEntries(entries, *limit, *sortByOffset)
+	}
+	// The summary hash keeps directory order whatever the order here
+	order := entries
+	if *sortByOffset {
+		order = byOffset(entries)
+	}
+	listed := order
+	if *directoryOrder {
+		listed = entries
+	}
+
+	if *manifestPath != "" || (list && *jsonList) {
+		manifest, err := buildManifest(paths.Root, hashList, others, format, headersOf(listed), *shift)
+		if err != nil {
+			exitWithError("Failed to build manifest: %v", err)
+		}
+		if *manifestPath != "" {
+			if err := writeManifestFile(*manifestPath, *manifestFormat, selectManifest(manifest, *manifestFilter)); err != nil {
+				exitWithError("Failed to write manifest: %v", err)
+			}
+		}
+		if list && *jsonList {
+			if err := writeManifest(os.Stdout, manifest); err != nil {
+				exitWithError("Failed to write manifest: %v", err)
+			}
+		}
+	}
+
+	if list {
+		if !*jsonList {
+			if err := listEntries(os.Stdout, listed, others, *shift); err != nil {
+				exitWithError("Failed to list entries: %v", err)
+			}
+		}
+		return
+	}
+	if n := checkCollisions(os.Stderr, entries); n > 0 && *failOnCollision {
+		exitWithError("%d output paths are shared by several entries", n)
+	}
+	if *dryRun {
+		reportDryRun(os.Stdout, listed)
+		return
+	}
+
+	archives, err := openArchives(archivePaths)
+	if err != nil {
+		exitWithError("Failed to open archive: %v", err)
+	}
+	defer closeArchives(archives)
+
+	readers, unmap := archiveReaders(archives, *useMmap)
+	defer unmap()
+	if combined.enabled {
+		info, err := archives[0].Stat()
+		if err != nil {
+			exitWithError("Failed to open archive: %v", err)
+		}
+		readers[0] = io.NewSectionReader(readers[0], dataStart, max(info.Size()-dataStart, 0))
+	}
+
+	x := &extractor{
+		archives:     readers,
+		format:       format,
+		shift:        *shift,
+		strict:       *strict,
+		skipExisting: *skipExisting && !*discard,
+		guessExt:     *guessExt,
+		progress:     *progress,
+		decompress:   *decompress,
+		keepGoing:    *keepGoing,
+		dedupe:       *dedupe && !*discard,
+		discard:      *discard,
+		bufferSize:   *bufferSize,
+		failOnEmpty:  *failOnEmpty,
+		retries:      *retries,
+		convert:      *convert,
+	}
+	if *checksums != "" {
+		x.checksums = make(map[string][]byte)
+	}
+	if *summaryHash {
+		x.digests = make(map[int][]byte, len(entries))
+	}
+	if *sortByOffset && *directoryOrder {
+		x.held = make(map[int]string, len(entries))
+	}
+	if *statePath != "" && !*discard {
+		if x.state, err = loadState(*statePath); err != nil {
+			exitWithError("Failed to load state: %v", err)
+		}
+	}
+	if *fromManifest != "" {
+		// Manifests carry no checksums to verify against
+		x.format = nfstools.FormatUnknown
+	}
+	switch {
+	case beQuiet:
+		x.verbosity = quiet
+	case beVerbose:
+		x.verbosity = verbose
+	}
+
+	if *toStdout {
+		if len(entries) != 1 {
+			exitWithError("-stdout needs exactly one entry, %d selected", len(entries))
+		}
+		if _, err := x.extract(context.Background(), entries[0].hdr, "", os.Stdout, nil); err != nil {
+			exitWithError("%v", err)
+		}
+		return
+	}
+
+	// The first interrupt lets running entries finish, a second one kills
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if *toZip != "" || *toTar != "" {
+		start := time.Now()
+		bundleErr := x.writeBundle(ctx, *toZip+*toTar, *toZip != "", order, paths.Root)
+		x.printHeld()
+		if *showStats || x.verbosity >= verbose {
+			x.stats.print(os.Stderr, time.Since(start), useColor(os.Stderr))
+		}
+		if bundleErr != nil {
+			code := exitEntryFailed
+			if ctx.Err() != nil {
+				code = exitInterrupted
+			}
+			unmap()
+			closeArchives(archives)
+			exitWith(code, "%v", bundleErr)
+		}
+		if x.digests != nil {
+			fmt.Printf("sha256 %x\n", foldDigests(x.digests))
+		}
+		return
+	}
+
+	start := time.Now()
+	ok := x.run(ctx, order, *workers)
+	x.printHeld()
+	if *showStats || x.verbosity >= verbose {
+		x.stats.print(os.Stderr, time.Since(start), useColor(os.Stderr))
+	}
+	if x.state != nil {
+		if err := x.state.save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save state: %v\n", err)
+		}
+	}
+	if x.checksums != nil {
+		// Files written before a failure are listed too
+		if err := writeChecksums(*checksums, paths.Root, x.checksums); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write checksums: %v\n", err)
+		}
+	}
+	if ctx.Err() != nil {
+		unmap()
+		closeArchives(archives)
+		exitWith(exitInterrupted, "interrupted after %d of %d entries", x.stats.done(), len(entries))
+	}
+	if x.stats.empty > 0 && x.verbosity > quiet {
+		fmt.Fprintf(os.Stderr, "warning: %d of %d entries are empty, the ZDIR format may be wrong\n", x.stats.empty, len(entries))
+	}
+	if !ok {
+		unmap()
+		closeArchives(archives)
+		exitWith(exitEntryFailed, "%d entries failed", x.stats.failed)
+	}
+
+	if x.digests != nil {
+		fmt.Printf("sha256 %x\n", foldDigests(x.digests))
+	}
+}
+
+func listEntries(w io.Writer, entries []entry, others map[uint32][]string, shift uint) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HASH\tOFFSET\tSIZE\tKNOWN\tNAME\tOTHER NAMES")
+	for _, e := range entries {
+		offset, err := nfstools.ResolveOffset(e.hdr, shift)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%08X\t%d\t%d\t%t\t%s\t%s\n", e.hdr.NameHash, offset, e.hdr.Size, e.known, e.outPath,
+			strings.Join(others[e.hdr.NameHash], ", "))
+	}
+	return tw.Flush()
+}
+
+// checkNames reports every known name that does not hash to the entry it
+// was matched with.
+func checkNames(w io.Writer, hasher nfstools.Hasher, hashList nfstools.HashList, headers []indexedHeader) {
+	var checked, bad int
+	for _, hdr := range headers {
+		name, ok := hashList[hdr.NameHash]
+		if !ok {
+			continue
+		}
+		checked++
+		if hash := hasher.Hash(name); hash != hdr.NameHash {
+			fmt.Fprintf(w, "name mismatch: %s hashes to %08X, not %08X\n", name, hash, hdr.NameHash)
+			bad++
+		}
+	}
+	fmt.Fprintf(w, "%d names checked, %d mismatched\n", checked, bad)
+}
+
+// otherNames returns, for every hash with more than one known name, the
+// names hashList did not keep.
+func otherNames(hasher nfstools.Hasher, hashList nfstools.HashList, collisions []nfstools.Collision) map[uint32][]string {
+	others := make(map[uint32][]string)
+	for hash, names := range hasher.Alternatives(collisions) {
+		others[hash] = slices.DeleteFunc(names, func(name string) bool { return name == hashList[hash] })
+	}
+	return others
+}
+
+func reportDryRun(w io.Writer, entries []entry) {
+	var total int64
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if seen[e.outPath] {
+			fmt.Fprintf(w, "collision: %s\n", e.outPath)
+		}
+		seen[e.outPath] = true
+
+		if !e.known {
+			fmt.Fprintf(w, "unknown: %s\n", e.outPath)
+		}
+		total += int64(e.hdr.Size)
+	}
+	fmt.Fprintf(w, "%d files, %d bytes would be written\n", len(entries), total)
+}
+
+// loadHashLists merges the given file lists in order over the embedded
+// one, so later lists win when names share a hash.
+func loadHashLists(paths []string, embedded bool, hasher nfstools.Hasher) (nfstools.HashList, []nfstools.Collision, error) {
+	var collisions []nfstools.Collision
+	hashList := make(nfstools.HashList)
+	if embedded {
+		collisions = hasher.LoadEmbedded(hashList)
+	}
+
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		c, err := hasher.Load(hashList, f)
+		f.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", p, err)
+		}
+		collisions = append(collisions, c...)
+	}
+	return hashList, collisions, nil
+}
+
+// writeUnknownHashes writes one hash per line for every header missing
+// from hashList.
+func writeUnknownHashes(name string, hashList nfstools.HashList, headers []indexedHeader) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, hdr := range headers {
+		if _, known := hashList[hdr.NameHash]; !known {
+			fmt.Fprintf(w, "%08X\n", hdr.NameHash)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadHeaders is nfstools.LoadHeaders that also accepts "-" for stdin and
+// warns when the detected format is a guess.
+func loadHeaders(name string, rf recordFormat) ([]nfstools.Header, nfstools.Format, error) {
+	var r interface {
+		io.Reader
+		io.ReaderAt
+	}
+	var size int64
+	if name == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, nfstools.FormatUnknown, err
+		}
+		r, size = bytes.NewReader(data), int64(len(data))
+	} else {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, nfstools.FormatUnknown, err
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			return nil, nfstools.FormatUnknown, err
+		}
+		r, size = f, info.Size()
+	}
+
+	format := rf.format
+	if format == nfstools.FormatUnknown {
+		format = detectFormat(name, io.NewSectionReader(r, 0, size), rf.order)
+	}
+	return nfstools.ReadHeaders(r, size, format, rf.order)
+}
+
+// detectFormat is nfstools.DetectFormat for the directory in r, warning
+// when it had to guess.
+func detectFormat(name string, r *io.SectionReader, order binary.ByteOrder) nfstools.Format {
+	head := make([]byte, min(r.Size(), nfstools.SniffLen))
+	n, _ := r.ReadAt(head, 0)
+	format, sure := nfstools.DetectFormat(head[:n], r.Size(), order)
+	if !sure && format != nfstools.FormatUnknown {
+		fmt.Fprintf(os.Stderr, "warning: %s could be ZDIR2002 or ZDIR2003, assuming %s (use -format to choose)\n", name, format)
+	}
+	return format
+}
+
+// recordFormat is how the records of a ZDIR are stored. An unknown format
+// is detected.
+type recordFormat struct {
+	format nfstools.Format
+	order  binary.ByteOrder
+}
+
+// formatFlag registers -format on fs, along with -endian as the byte order
+// goes with the layout wherever a ZDIR is read.
+func formatFlag(fs *flag.FlagSet) *recordFormat {
+	rf := &recordFormat{order: binary.LittleEndian}
+	fs.Func("format", "ZDIR record layout, 2002 or 2003 (default detected)", func(s string) error {
+		f, err := nfstools.ParseFormat(s)
+		rf.format = f
+		return err
+	})
+	fs.Func("endian", "byte order of the ZDIR records, big or little (default little)", func(s string) error {
+		switch s {
+		case "big":
+			rf.order = binary.BigEndian
+		case "little":
+			rf.order = binary.LittleEndian
+		default:
+			return errors.New("want big or little")
+		}
+		return nil
+	})
+	return rf
+}
+
+func exitWithError(format string, args ...any) {
+	exitWith(exitError, format, args...)
+}
+
+func exitWith(code int, format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(code)
+}
+
+func openArchives(paths []string) ([]*os.File, error) {
+	paths, err := expandArchives(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	archives := make([]*os.File, 0, len(paths))
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			closeArchives(archives)
+			return nil, err
+		}
+		archives = append(archives, f)
+	}
+	return archives, nil
+}
+
+func closeArchives(archives []*os.File) {
+	for _, f := range archives {
+		f.Close()
+	}
+}
+
+// archiveReaders returns what entries are read from, mapping each archive
+// into memory when asked to and falling back to plain reads if that fails.
+func archiveReaders(archives []*os.File, useMmap bool) ([]io.ReaderAt, func()) {
+	var maps []*nfstools.MappedArchive
+	readers := make([]io.ReaderAt, len(archives))
+	for i, f := range archives {
+		readers[i] = f
+		if !useMmap {
+			continue
+		}
+
+		m, err := nfstools.MapArchive(f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %s: mmap failed, reading normally: %v\n", f.Name(), err)
+			continue
+		}
+		readers[i] = m
+		maps = append(maps, m)
+	}
+
+	return readers, func() {
+		for _, m := range maps {
+			m.Close()
+		}
+	}
+}
+
+// printUsage describes every way to run the program and the options of
+// extract.
+func printUsage() {
+	w := flag.CommandLine.Output()
+	name := progName()
+	fmt.Fprintf(w, "Usage: %s [options] <ZDIR> <ZZDATA{0..3}>\n", name)
+	fmt.Fprintf(w, "       %s extract [options] -name NAME -stdout <ZDIR> <ZZDATA{0..3}>\n", name)
+	fmt.Fprintf(w, "       %s extract [options] -from-manifest FILE <ZZDATA{0..3}>\n", name)
+	fmt.Fprintf(w, "       %s extract [options] -combined <FILE>\n", name)
+	fmt.Fprintf(w, "       %s extract [options] <ZDIR> <DIR holding the ZZDATA files>\n", name)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "       %s %s %s\n", name, cmd.name, cmd.synopsis)
+	}
+	fmt.Fprintf(w, "       %s help\n", name)
+	fmt.Fprintf(w, "\nRun \"%s <command> -h\" for the options of a command. Extract options:\n", name)
+	flag.PrintDefaults()
+}
+
+// newFlagSet returns the flag set of the named subcommand.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		for _, cmd := range commands {
+			if cmd.name == name {
+				fmt.Fprintf(fs.Output(), "Usage: %s %s %s\n", progName(), name, cmd.synopsis)
+			}
+		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// usageError prints the usage of fs and exits.
+func usageError(fs *flag.FlagSet) {
+	fs.Usage()
+	os.Exit(exitUsage)
+}
+
+func progName() string {
+	return path.Base(os.Args[0])
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+
+	"nfstools"
+)
+
+type manifestEntry struct {
+	Name      *string  `json:"name"`
+	Hash      string   `json:"hash"`
+	Offset    int64    `json:"offset"`
+	Size      uint32   `json:"size"`
+	ArchiveID *uint32  `json:"archive_id,omitempty"`
+	Others    []string `json:"others,omitempty"`
+	Safe      bool     `json:"safe"` // name stays below the output directory
+	index     int      // position in the directory, for the CSV
+}
+
+// buildManifest describes every header in directory order. Entries are
+// marked unsafe when their name would escape root.
+func buildManifest(root string, hashList nfstools.HashList, others map[uint32][]string, format nfstools.Format, headers []indexedHeader, shift uint) ([]manifestEntry, error) {
+	entries := make([]manifestEntry, len(headers))
+	for i, hdr := range headers {
+		offset, err := nfstools.ResolveOffset(hdr.Header, shift)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := manifestEntry{
+			Hash:   fmt.Sprintf("%08X", hdr.NameHash),
+			Offset: offset,
+			Size:   hdr.Size,
+			Others: others[hdr.NameHash],
+			index:  hdr.index,
+		}
+		_, err = nfstools.BuildOutputPath(root, hashList, hdr.Header)
+		entry.Safe = !errors.Is(err, nfstools.ErrPathTraversal) && !errors.Is(err, nfstools.ErrUnsafeName)
+		if name, ok := hashList[hdr.NameHash]; ok {
+			entry.Name = &name
+		}
+		if format == nfstools.Format2003 {
+			archiveID := hdr.ArchiveID
+			entry.ArchiveID = &archiveID
+		}
+		entries[i] = entry
+	}
+	return entries, nil
+}
+
+// selectManifest keeps the known or the unknown entries, or all of them.
+func selectManifest(entries []manifestEntry, which string) []manifestEntry {
+	if which == "all" {
+		return entries
+	}
+	return slices.DeleteFunc(slices.Clone(entries), func(e manifestEntry) bool {
+		return (e.Name != nil) != (which == "known")
+	})
+}
+
+func writeManifest(w io.Writer, entries []manifestEntry) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+// writeManifestCSV writes one row per entry, with the archive column left
+// empty for ZDIR2002 entries.
+func writeManifestCSV(w io.Writer, entries []manifestEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"index", "name", "hash_hex", "offset", "size", "archive_id", "known"})
+	for _, e := range entries {
+		var name, archiveID string
+		if e.Name != nil {
+			name = *e.Name
+		}
+		if e.ArchiveID != nil {
+			archiveID = strconv.FormatUint(uint64(*e.ArchiveID), 10)
+		}
+		cw.Write([]string{
+			strconv.Itoa(e.index),
+			name,
+			e.Hash,
+			strconv.FormatInt(e.Offset, 10),
+			strconv.FormatUint(uint64(e.Size), 10),
+			archiveID,
+			strconv.FormatBool(e.Name != nil),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeManifestFile writes entries to name as "json" or "csv".
+func writeManifestFile(name, format string, entries []manifestEntry) error {
+	write := writeManifest
+	if format == "csv" {
+		write = writeManifestCSV
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(f, entries); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readManifestFile turns a manifest written by -manifest back into
+// headers, along with the names it gives them. Offsets must be aligned to
+// 1<<shift bytes. The format is 2003 when any entry names its archive.
+func readManifestFile(name string, shift uint) ([]nfstools.Header, nfstools.HashList, nfstools.Format, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, nfstools.FormatUnknown, err
+	}
+	defer f.Close()
+
+	var entries []manifestEntry
+	if err := json.NewDecoder(f).Decode(&entries); err != nil {
+		return nil, nil, nfstools.FormatUnknown, fmt.Errorf("%s: %w", name, err)
+	}
+
+	format := nfstools.Format2002
+	names := make(nfstools.HashList)
+	headers := make([]nfstools.Header, len(entries))
+	for i, e := range entries {
+		hash, err := strconv.ParseUint(e.Hash, 16, 32)
+		if err != nil {
+			return nil, nil, nfstools.FormatUnknown, fmt.Errorf("%s: entry %d: invalid hash %q", name, i, e.Hash)
+		}
+		if shift >= 63 || e.Offset < 0 || e.Offset&(1<<shift-1) != 0 || e.Offset>>shift > math.MaxUint32 {
+			return nil, nil, nfstools.FormatUnknown, fmt.Errorf("%s: entry %d: offset %d cannot be stored with a shift of %d", name, i, e.Offset, shift)
+		}
+
+		hdr := nfstools.Header{
+			NameHash:    uint32(hash),
+			LocalOffset: uint32(e.Offset >> shift),
+			TotalOffset: uint32(e.Offset >> shift),
+			Size:        e.Size,
+		}
+		if e.ArchiveID != nil {
+			hdr.ArchiveID = *e.ArchiveID
+			format = nfstools.Format2003
+		}
+		if e.Name != nil {
+			names[hdr.NameHash] = *e.Name
+		}
+		headers[i] = hdr
+	}
+	return headers, names, format, nil
+}
+
+// changedSince returns the headers whose hash is missing from previous or
+// that moved or changed size since.
+func changedSince(previous []nfstools.Header, headers []indexedHeader) []indexedHeader {
+	type place struct{ offset, size uint32 }
+	seen := make(map[uint32]place, len(previous))
+	for _, hdr := range previous {
+		seen[hdr.NameHash] = place{hdr.LocalOffset, hdr.Size}
+	}
+
+	changed := make([]indexedHeader, 0, len(headers))
+	for _, hdr := range headers {
+		if p, ok := seen[hdr.NameHash]; !ok || p != (place{hdr.LocalOffset, hdr.Size}) {
+			changed = append(changed, hdr)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+
+	"nfstools"
+)
+
+// span is the byte range an entry occupies in its archive.
+type span struct {
+	hdr        nfstools.Header
+	start, end int64
+}
+
+// checkOverlaps reports every entry whose bytes overlap an earlier one in
+// the same archive. Entries sharing exactly the same range are taken as
+// deliberate and left out. It returns the number of overlaps found.
+func checkOverlaps(w io.Writer, hashList nfstools.HashList, headers []indexedHeader, shift uint) int {
+	spans := make([]span, 0, len(headers))
+	for _, hdr := range headers {
+		offset, err := nfstools.ResolveOffset(hdr.Header, shift)
+		if err != nil || hdr.Size == 0 {
+			continue
+		}
+		spans = append(spans, span{hdr.Header, offset, offset + int64(hdr.Size)})
+	}
+	slices.SortStableFunc(spans, func(a, b span) int {
+		return cmp.Or(cmp.Compare(a.hdr.ArchiveID, b.hdr.ArchiveID), cmp.Compare(a.start, b.start))
+	})
+
+	var overlaps int
+	var far span // the entry reaching furthest so far in this archive
+	for i, cur := range spans {
+		if i == 0 || cur.hdr.ArchiveID != far.hdr.ArchiveID {
+			far = cur
+			continue
+		}
+		if cur.start < far.end && (cur.start != far.start || cur.end != far.end) {
+			fmt.Fprintf(w, "overlap: %s [%d, %d) and %s [%d, %d) in archive %d\n",
+				entryName(hashList, far.hdr), far.start, far.end,
+				entryName(hashList, cur.hdr), cur.start, cur.end, cur.hdr.ArchiveID)
+			overlaps++
+		}
+		if cur.end > far.end {
+			far = cur
+		}
+	}
+	return overlaps
+}
+
+// entryName is the known name of hdr, or its hash.
+func entryName(hashList nfstools.HashList, hdr nfstools.Header) string {
+	if name, ok := hashList.Name(hdr.NameHash); ok {
+		return name
+	}
+	return fmt.Sprintf("%08X", hdr.NameHash)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"nfstools"
+)
+
+// runPack builds a ZDIR2002 and its ZZDATA from a directory tree.
+func runPack(args []string) {
+	fs := newFlagSet("pack")
+	shift := fs.Uint("offset-shift", nfstools.OffsetShift, "align entries to 1<<`N` bytes")
+	hashing := addHashFlags(fs)
+	fs.Parse(args)
+	hasher := hashing.hasher()
+
+	if fs.NArg() != 3 {
+		usageError(fs)
+	}
+
+	zdir, err := os.Create(fs.Arg(1))
+	if err != nil {
+		exitWithError("Failed to create ZDIR: %v", err)
+	}
+	defer zdir.Close()
+
+	data, err := os.Create(fs.Arg(2))
+	if err != nil {
+		exitWithError("Failed to create archive: %v", err)
+	}
+	defer data.Close()
+
+	w := bufio.NewWriter(data)
+	headers, err := nfstools.Pack(fs.Arg(0), w, zdir, *shift, hasher)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		exitWithError("Failed to pack: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "%d files packed\n", len(headers))
+}
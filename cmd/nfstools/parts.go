@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// archiveParts returns the ZZDATA<N> files in dir ordered by N, which
+// must count up from 0 without gaps. Extensions and case are ignored.
+func archiveParts(dir string) ([]string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make(map[int]string)
+	for _, f := range files {
+		if !f.Type().IsRegular() {
+			continue
+		}
+		name := f.Name()
+		stem := strings.ToUpper(strings.TrimSuffix(name, filepath.Ext(name)))
+		digits, ok := strings.CutPrefix(stem, "ZZDATA")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(digits)
+		if err != nil || n < 0 {
+			continue
+		}
+		if other, ok := parts[n]; ok {
+			return nil, fmt.Errorf("%s: both %s and %s are part %d", dir, other, name, n)
+		}
+		parts[n] = name
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("%s: no ZZDATA files", dir)
+	}
+
+	paths := make([]string, len(parts))
+	for i := range paths {
+		name, ok := parts[i]
+		if !ok {
+			return nil, fmt.Errorf("%s: part %d is missing", dir, i)
+		}
+		paths[i] = filepath.Join(dir, name)
+	}
+	return paths, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"nfstools"
+)
+
+// entry is a header together with where it will be written.
+type entry struct {
+	hdr     nfstools.Header
+	outPath string
+	known   bool
+	index   int // position in the directory
+}
+
+// indexedHeader is a header with its position in the directory, which
+// stays the same however entries are selected.
+type indexedHeader struct {
+	nfstools.Header
+	index int
+}
+
+// numbered pairs every header with its position.
+func numbered(headers []nfstools.Header) []indexedHeader {
+	indexed := make([]indexedHeader, len(headers))
+	for i, hdr := range headers {
+		indexed[i] = indexedHeader{hdr, i}
+	}
+	return indexed
+}
+
+// headersOf returns the headers of entries along with their positions.
+func headersOf(entries []entry) []indexedHeader {
+	headers := make([]indexedHeader, len(entries))
+	for i, e := range entries {
+		headers[i] = indexedHeader{e.hdr, e.index}
+	}
+	return headers
+}
+
+// errUnknownSkipped marks unknown entries left out on purpose.
+var errUnknownSkipped = errors.New("unknown entry skipped")
+
+// layout decides where entries end up on disk. Names are placed by
+// nfstools.PathOptions; layout adds what needs the whole directory or only
+// concerns the command.
+type layout struct {
+	nfstools.PathOptions
+	byArchive   bool
+	skipUnknown bool
+	caseSafe    bool
+	renames     map[uint32]string // paths chosen by hand, placed as they are
+}
+
+// plan resolves the output path of every header, in directory order.
+// Entries left without a name by stripping, and unknown entries when
+// skipping those, are dropped. Renamed entries count as known.
+func (l *layout) plan(hashList nfstools.HashList, headers []indexedHeader) []entry {
+	var folded map[string]string
+	if l.caseSafe {
+		folded = make(map[string]string, len(headers))
+	}
+	// Flattening and lowercasing can map distinct names to one path
+	var taken map[string]bool
+	if l.Flatten || l.Lower {
+		taken = make(map[string]bool, len(headers))
+	}
+
+	entries := make([]entry, 0, len(headers))
+	for _, ih := range headers {
+		hdr := ih.Header
+		_, known := hashList[hdr.NameHash]
+		if _, renamed := l.renames[hdr.NameHash]; renamed {
+			known = true
+		}
+		outPath, err := l.outputPath(hashList, hdr)
+		if err != nil {
+			if err != errUnknownSkipped {
+				fmt.Fprintf(os.Stderr, "warning: %v, skipping\n", err)
+			}
+			continue
+		}
+
+		if taken != nil && known {
+			if taken[outPath] {
+				renamed := withHash(outPath, hdr.NameHash)
+				fmt.Fprintf(os.Stderr, "warning: %s is already taken, extracting as %s\n", outPath, renamed)
+				outPath = renamed
+			}
+			taken[outPath] = true
+		}
+
+		if folded != nil {
+			key := strings.ToLower(outPath)
+			if first, ok := folded[key]; ok && first != outPath {
+				renamed := withHash(outPath, hdr.NameHash)
+				fmt.Fprintf(os.Stderr, "warning: %s differs from %s only by case, extracting as %s\n", outPath, first, renamed)
+				outPath, key = renamed, strings.ToLower(renamed)
+			}
+			if _, ok := folded[key]; !ok {
+				folded[key] = outPath
+			}
+		}
+
+		entries = append(entries, entry{hdr: hdr, outPath: outPath, known: known, index: ih.index})
+	}
+	return entries
+}
+
+// outputPath resolves where hdr goes. Renamed entries go to their path
+// below the output directory, without the name being transformed. It fails
+// for entries that should not be extracted at all.
+func (l *layout) outputPath(hashList nfstools.HashList, hdr nfstools.Header) (string, error) {
+	opts := l.PathOptions
+	if l.byArchive {
+		opts.Prefix = filepath.Join(opts.Prefix, fmt.Sprintf("archive%d", hdr.ArchiveID))
+	}
+	if target, ok := l.renames[hdr.NameHash]; ok {
+		opts.StripComponents, opts.Lower, opts.Flatten = 0, false, false
+		hashList = nfstools.HashList{hdr.NameHash: target}
+	}
+
+	_, known := hashList[hdr.NameHash]
+	if !known && l.skipUnknown {
+		return "", errUnknownSkipped
+	}
+	outPath, err := opts.OutputPath(hashList, hdr)
+	switch {
+	case errors.Is(err, nfstools.ErrNameSanitized):
+		fmt.Fprintf(os.Stderr, "warning: %v, extracting as %s\n", err, outPath)
+		return outPath, nil
+	case errors.Is(err, nfstools.ErrPathTraversal), errors.Is(err, nfstools.ErrUnsafeName):
+		// Escaping or unusable names go where unknown entries do
+		if l.skipUnknown {
+			return "", errUnknownSkipped
+		}
+		fmt.Fprintf(os.Stderr, "warning: %v, extracting as %s\n", err, outPath)
+		return outPath, nil
+	}
+	return outPath, err
+}
+
+// outputPath wraps nfstools.BuildOutputPath, warning about names that
+// had to be replaced.
+func outputPath(root string, hashList nfstools.HashList, hdr nfstools.Header) string {
+	outPath, err := nfstools.BuildOutputPath(root, hashList, hdr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v, extracting as %s\n", err, outPath)
+	}
+	return outPath
+}
+
+// checkCollisions reports every output path shared by more than one entry,
+// with the hashes of those entries, and returns how many there are.
+func checkCollisions(w io.Writer, entries []entry) int {
+	var paths []string
+	hashes := make(map[string][]string, len(entries))
+	for _, e := range entries {
+		if _, ok := hashes[e.outPath]; !ok {
+			paths = append(paths, e.outPath)
+		}
+		hashes[e.outPath] = append(hashes[e.outPath], fmt.Sprintf("%08X", e.hdr.NameHash))
+	}
+
+	n := 0
+	for _, p := range paths {
+		if len(hashes[p]) > 1 {
+			fmt.Fprintf(w, "warning: %s is written by %d entries: %s\n", p, len(hashes[p]), strings.Join(hashes[p], ", "))
+			n++
+		}
+	}
+	return n
+}
+
+// withHash makes p unique by adding hash in front of its extension.
+func withHash(p string, hash uint32) string {
+	ext := filepath.Ext(p)
+	return fmt.Sprintf("%s_%08X%s", strings.TrimSuffix(p, ext), hash, ext)
+}
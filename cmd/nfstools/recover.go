@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// runRecover guesses the names of unknown entries by hashing every
+// combination of prefix, word and extension.
+func runRecover(args []string) {
+	var fileLists, prefixes, exts stringList
+	fs := newFlagSet("recover")
+	fs.Var(&prefixes, "prefix", "prepend `path` to every word, may be repeated")
+	fs.Var(&exts, "ext", "append `extension` to every word, may be repeated")
+	fs.Var(&fileLists, "filelist", "additional file name list, may be repeated")
+	noEmbedded := fs.Bool("no-embedded", false, "ignore the bundled file name list")
+	workers := fs.Int("j", runtime.GOMAXPROCS(0), "number of concurrent hashers")
+	forceFormat := formatFlag(fs)
+	hashing := addHashFlags(fs)
+	fs.Parse(args)
+	hasher := hashing.hasher()
+
+	if fs.NArg() != 2 {
+		usageError(fs)
+	}
+	if len(prefixes) == 0 {
+		prefixes = stringList{""}
+	}
+	if len(exts) == 0 {
+		exts = stringList{""}
+	}
+
+	headers, _, err := loadHeaders(fs.Arg(0), *forceFormat)
+	if err != nil {
+		exitWith(exitNoZDIR, "Failed to load headers: %v", err)
+	}
+	hashList, _, err := loadHashLists(fileLists, !*noEmbedded, hasher)
+	if err != nil {
+		exitWithError("Failed to load file list: %v", err)
+	}
+
+	unknown := make(map[uint32]bool)
+	for _, hdr := range headers {
+		if _, known := hashList[hdr.NameHash]; !known {
+			unknown[hdr.NameHash] = true
+		}
+	}
+
+	words, err := os.Open(fs.Arg(1))
+	if err != nil {
+		exitWithError("Failed to open word list: %v", err)
+	}
+	defer words.Close()
+
+	var mu sync.Mutex
+	found := make(map[uint32]bool)
+	var wg sync.WaitGroup
+	jobs := make(chan string, 256)
+	for range max(*workers, 1) {
+		wg.Go(func() {
+			for word := range jobs {
+				for _, prefix := range prefixes {
+					for _, ext := range exts {
+						name := prefix + word + ext
+						hash := hasher.Hash(name)
+						if !unknown[hash] {
+							continue
+						}
+						mu.Lock()
+						if !found[hash] {
+							found[hash] = true
+							fmt.Printf("%08X = %s\n", hash, name)
+						}
+						mu.Unlock()
+					}
+				}
+			}
+		})
+	}
+
+	var tried int
+	scanner := bufio.NewScanner(words)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" {
+			continue
+		}
+		jobs <- word
+		tried++
+	}
+	close(jobs)
+	wg.Wait()
+	if err := scanner.Err(); err != nil {
+		exitWithError("Failed to read word list: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "%d candidates, %d of %d unknown hashes recovered\n",
+		tried*len(prefixes)*len(exts), len(found), len(unknown))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// readRenameMap reads a file of hash<TAB>path lines naming entries by hand.
+// Hashes are hexadecimal with an optional 0x prefix. Blank lines and lines
+// starting with # are skipped.
+func readRenameMap(name string) (map[uint32]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names := make(map[uint32]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		hashText, outPath, ok := strings.Cut(text, "\t")
+		if !ok || outPath == "" {
+			return nil, fmt.Errorf("%s:%d: want hash<TAB>path", name, line)
+		}
+		hash, err := parseHash(strings.TrimSpace(hashText))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		names[hash] = outPath
+	}
+	return names, scanner.Err()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"nfstools"
+)
+
+// runSelftest checks the bundled file list for blank lines, repeated
+// names and names that share a hash.
+func runSelftest(args []string) {
+	fs := newFlagSet("selftest")
+	hashing := addHashFlags(fs)
+	fs.Parse(args)
+	hasher := hashing.hasher()
+
+	names := nfstools.EmbeddedNames()
+	seen := make(map[uint32]string, len(names))
+	var blank, duplicates, collisions int
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			fmt.Printf("line %d: blank\n", i+1)
+			blank++
+			continue
+		}
+		if strings.HasPrefix(name, "#") {
+			continue
+		}
+
+		hash := hasher.Hash(name)
+		existing, ok := seen[hash]
+		switch {
+		case !ok:
+			seen[hash] = name
+		case hasher.Same(existing, name):
+			fmt.Printf("line %d: duplicate %s\n", i+1, name)
+			duplicates++
+		default:
+			fmt.Printf("line %d: %s collides with %s (%08X)\n", i+1, name, existing, hash)
+			collisions++
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d lines, %d distinct hashes, %d blank, %d duplicates, %d collisions\n",
+		len(names), len(seen), blank, duplicates, collisions)
+	if blank+duplicates+collisions > 0 {
+		os.Exit(exitError)
+	}
+}
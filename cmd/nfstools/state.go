@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// saveInterval is how often the state file is rewritten at most while
+// entries complete, so huge runs do not spend their time saving it.
+const saveInterval = time.Second
+
+// runState remembers which entries an interrupted run already wrote. Entries
+// are keyed by their index in the directory and checked against their hash,
+// so the state carries over to any run over the same directory, whichever
+// entries it selects.
+type runState struct {
+	path  string
+	done  map[int]string // index to hash
+	saved time.Time
+}
+
+// loadState reads the state file at path, which may not exist yet.
+func loadState(path string) (*runState, error) {
+	s := &runState{path: path, done: make(map[int]string)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.done); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// completed reports whether e was written by an earlier run.
+func (s *runState) completed(e entry) bool {
+	return s.done[e.index] == fmt.Sprintf("%08X", e.hdr.NameHash)
+}
+
+// record marks e as written, saving the state unless that was done less
+// than saveInterval ago.
+func (s *runState) record(e entry) error {
+	s.done[e.index] = fmt.Sprintf("%08X", e.hdr.NameHash)
+	if time.Since(s.saved) < saveInterval {
+		return nil
+	}
+	return s.save()
+}
+
+// save replaces the state file, going through a temporary file so a crash
+// never leaves it half written.
+func (s *runState) save() error {
+	data, err := json.Marshal(s.done)
+	if err != nil {
+		return err
+	}
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	s.saved = time.Now()
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"nfstools"
+)
+
+// runVerify checks an extracted tree against the ZDIR it came from. Only
+// entries with a known name are checked.
+func runVerify(args []string) {
+	var root string
+	var fileLists stringList
+	fs := newFlagSet("verify")
+	fs.StringVar(&root, "o", nfstools.ExtractedRoot, "shorthand for -output")
+	fs.StringVar(&root, "output", nfstools.ExtractedRoot, "directory the files were extracted into")
+	fs.Var(&fileLists, "filelist", "additional file name list, may be repeated")
+	noEmbedded := fs.Bool("no-embedded", false, "ignore the bundled file name list")
+	forceFormat := formatFlag(fs)
+	hashing := addHashFlags(fs)
+	fs.Parse(args)
+	hasher := hashing.hasher()
+
+	if fs.NArg() != 1 {
+		usageError(fs)
+	}
+
+	headers, format, err := loadHeaders(fs.Arg(0), *forceFormat)
+	if err != nil {
+		exitWith(exitNoZDIR, "Failed to load headers: %v", err)
+	}
+	if len(headers) == 0 {
+		fmt.Fprintf(os.Stderr, "%s: directory has no entries, nothing to do\n", fs.Arg(0))
+		return
+	}
+	hashList, _, err := loadHashLists(fileLists, !*noEmbedded, hasher)
+	if err != nil {
+		exitWithError("Failed to load file list: %v", err)
+	}
+
+	var checked, bad int
+	for _, hdr := range headers {
+		if _, known := hashList[hdr.NameHash]; !known {
+			continue
+		}
+
+		checked++
+		outPath := outputPath(root, hashList, hdr)
+		if err := verifyFile(outPath, format, hdr); err != nil {
+			fmt.Println(err)
+			bad++
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d files checked, %d bad\n", checked, bad)
+	if bad > 0 {
+		os.Exit(exitError)
+	}
+}
+
+func verifyFile(outPath string, format nfstools.Format, hdr nfstools.Header) error {
+	f, err := os.Open(outPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("missing: %s", outPath)
+		}
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != int64(hdr.Size) {
+		return fmt.Errorf("size mismatch: %s (expected %d, got %d)", outPath, hdr.Size, info.Size())
+	}
+
+	if format == nfstools.Format2003 {
+		sum := nfstools.NewChecksum()
+		if _, err := io.Copy(sum, f); err != nil {
+			return err
+		}
+		if sum.Sum32() != hdr.Checksum {
+			return fmt.Errorf("%w: %s (stored %08X, computed %08X)", nfstools.ErrChecksumMismatch, outPath, hdr.Checksum, sum.Sum32())
+		}
+	}
+	return nil
+}
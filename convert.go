@@ -0,0 +1,19 @@
+package nfstools
+
+import "io"
+
+// Converter turns an entry into another form while it is extracted.
+type Converter func(in io.Reader, out io.Writer) error
+
+// Converters maps the extension GuessExt detects for an entry to the
+// converter applied to it on request. Entries of other types are extracted
+// as they are. Contributors can register real format converters here.
+var Converters = map[string]Converter{
+	".fsh": CopyThrough, // example only
+}
+
+// CopyThrough is a Converter that leaves the data unchanged.
+func CopyThrough(in io.Reader, out io.Writer) error {
+	_, err := io.Copy(out, in)
+	return err
+}
@@ -0,0 +1,16 @@
+package nfstools
+
+import "errors"
+
+// Errors returned, wrapped, by this package and its command. Use errors.Is
+// to test for them.
+var (
+	ErrInvalidZDIRSize        = errors.New("invalid header file size")
+	ErrArchiveIndexOutOfRange = errors.New("archive index out of range")
+	ErrPathTraversal          = errors.New("path traversal")
+	ErrUnsafeName             = errors.New("unusable file name")
+	ErrNameSanitized          = errors.New("unusable characters replaced")
+	ErrNameStripped           = errors.New("nothing left of name")
+	ErrUnknownDirEscapes      = errors.New("unknown directory outside the output")
+	ErrChecksumMismatch       = errors.New("checksum mismatch")
+)
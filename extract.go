@@ -0,0 +1,406 @@
+package nfstools
+
+import (
+	"bytes"
+	"cmp"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+)
+
+// NewChecksum returns the hash used to verify ZDIR2003 entries.
+// TODO: the algorithm used by the games is unknown, CRC32 is a placeholder.
+var NewChecksum = func() hash.Hash32 { return crc32.NewIEEE() }
+
+// NameByHash names an entry after its name hash, which stays the same
+// across archive versions.
+func NameByHash(hdr Header) string {
+	return fmt.Sprintf("%08X", hdr.NameHash)
+}
+
+// NameByOffset names an entry after its offset, as older releases did.
+func NameByOffset(hdr Header) string {
+	return fmt.Sprintf("%X", hdr.LocalOffset)
+}
+
+// BuildOutputPath returns where hdr should be written below root. Entries
+// missing from hashList are named by NameByHash inside UnknownDir.
+// If the resolved name would escape root, or is not a valid file name on
+// this system, the unknown path is returned together with an error
+// describing why. Control characters in the name are replaced by
+// underscores, in which case the error wraps ErrNameSanitized and the path
+// is still usable.
+func BuildOutputPath(root string, hashList HashList, hdr Header) (string, error) {
+	return PathOptions{Root: root}.OutputPath(hashList, hdr)
+}
+
+// PathOptions controls how OutputPath places entries.
+type PathOptions struct {
+	Root   string
+	Prefix string // directory below Root every entry goes in
+
+	// UnknownDir is the directory below Root and Prefix for entries
+	// without a usable name, the package's UnknownDir when empty.
+	UnknownDir string
+
+	// UnknownName names the entries in UnknownDir, NameByHash when nil.
+	UnknownName func(Header) string
+
+	// The rest only apply to known names, in this order.
+	StripComponents uint // leading components to drop
+	Lower           bool // lowercase the name
+	Flatten         bool // drop the directories of the name
+}
+
+// OutputPath is BuildOutputPath with the name transformed as o asks. It
+// fails without returning a path for names StripComponents leaves nothing
+// of, and for an UnknownDir outside Root and Prefix.
+func (o PathOptions) OutputPath(hashList HashList, hdr Header) (string, error) {
+	base := filepath.Join(o.Root, o.Prefix)
+	unknownName := o.UnknownName
+	if unknownName == nil {
+		unknownName = NameByHash
+	}
+	unknownPath := filepath.Join(base, cmp.Or(o.UnknownDir, UnknownDir), unknownName(hdr))
+	if !isWithinRoot(base, unknownPath) {
+		return "", fmt.Errorf("%q escapes %s: %w", o.UnknownDir, base, ErrUnknownDirEscapes)
+	}
+	name, ok := hashList[hdr.NameHash]
+	if !ok {
+		return unknownPath, nil
+	}
+
+	if o.StripComponents > 0 {
+		elems := strings.FieldsFunc(name, func(r rune) bool { return r == '\\' || r == '/' })
+		if uint(len(elems)) <= o.StripComponents {
+			return "", fmt.Errorf("%s has no more than %d path components: %w", name, o.StripComponents, ErrNameStripped)
+		}
+		name = strings.Join(elems[o.StripComponents:], `\`)
+	}
+	if o.Lower {
+		name = strings.ToLower(name)
+	}
+	if o.Flatten {
+		if b := path.Base(strings.ReplaceAll(name, `\`, "/")); b != "." && b != ".." && b != "/" {
+			name = b
+		}
+	}
+
+	clean, sanitized := sanitizeName(name)
+	normalized := filepath.FromSlash(strings.ReplaceAll(clean, `\`, `/`))
+	outPath := filepath.Join(base, normalized)
+	if !isWithinRoot(base, outPath) {
+		return unknownPath, fmt.Errorf("%q escapes %s: %w", name, base, ErrPathTraversal)
+	}
+	if runtime.GOOS == "windows" && !filepath.IsLocal(strings.TrimLeft(normalized, `\`)) {
+		// Reserved names such as NUL or COM1
+		return unknownPath, fmt.Errorf("%q: %w", name, ErrUnsafeName)
+	}
+	if sanitized {
+		return outPath, fmt.Errorf("%q: %w", name, ErrNameSanitized)
+	}
+	return outPath, nil
+}
+
+// sanitizeName replaces the characters of name that cannot appear in file
+// names with underscores, reporting whether there were any.
+func sanitizeName(name string) (string, bool) {
+	sanitized := false
+	clean := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7F || r == utf8.RuneError ||
+			runtime.GOOS == "windows" && strings.ContainsRune(`<>:"|?*`, r) {
+			sanitized = true
+			return '_'
+		}
+		return r
+	}, name)
+	return clean, sanitized
+}
+
+// isWithinRoot reports whether p resolves to somewhere below root.
+func isWithinRoot(root, p string) bool {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return false
+	}
+	absPath, err := filepath.Abs(p)
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(absRoot, absPath)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// checkBounds makes sure [offset, offset+size) lies within archive, as far
+// as the archive's size can be determined.
+func checkBounds(archive io.ReaderAt, offset, size int64) error {
+	if offset < 0 || size < 0 {
+		return fmt.Errorf("invalid range %d+%d", offset, size)
+	}
+
+	archiveSize, ok := sizeOf(archive)
+	if !ok {
+		return nil
+	}
+	// Compare without computing offset+size so it can't overflow
+	if offset > archiveSize || size > archiveSize-offset {
+		return fmt.Errorf("range %d+%d is outside the %d byte archive", offset, size, archiveSize)
+	}
+	return nil
+}
+
+func sizeOf(r io.ReaderAt) (int64, bool) {
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size(), true
+	case interface{ Stat() (os.FileInfo, error) }:
+		info, err := r.Stat()
+		if err != nil {
+			return 0, false
+		}
+		return info.Size(), true
+	}
+	return 0, false
+}
+
+// CopyOptions controls how the bytes of an entry are copied out.
+type CopyOptions struct {
+	// Sum, when not nil, is fed the entry bytes as stored in the archive.
+	Sum hash.Hash32
+
+	// Check, when not nil, is called once the whole entry was copied and
+	// before the output is closed, typically to compare Sum against the
+	// stored checksum. An error from it fails the copy, so files are
+	// abandoned as for any other failed copy.
+	Check func() error
+
+	// Decompress inflates entries that start with a zlib header. Other
+	// entries are copied verbatim.
+	Decompress bool
+
+	// BufferSize is the size of the copy buffer. When zero it is picked
+	// per entry, never larger than needed.
+	BufferSize int
+}
+
+func (o CopyOptions) check() error {
+	if o.Check == nil {
+		return nil
+	}
+	return o.Check()
+}
+
+func (o CopyOptions) buffer(size int64) []byte {
+	n := o.BufferSize
+	if n <= 0 {
+		n = bufferSize
+		if !o.Decompress {
+			n = int(min(int64(n), max(size, 1)))
+		}
+	}
+	return make([]byte, n)
+}
+
+// ExtractFile copies size bytes at offset into outPath and returns the
+// number of bytes written. The data goes to a temporary file next to
+// outPath first, so a failed or interrupted copy never leaves a partial
+// file at outPath.
+func ExtractFile(archive io.ReaderAt, outPath string, offset, size int64, opts CopyOptions) (int64, error) {
+	return ExtractToSink(DiskSink{}, archive, outPath, offset, size, opts)
+}
+
+// ExtractToSink is like ExtractFile but creates outPath through sink.
+func ExtractToSink(sink OutputSink, archive io.ReaderAt, outPath string, offset, size int64, opts CopyOptions) (int64, error) {
+	return extractToSink(context.Background(), sink, archive, outPath, offset, size, opts)
+}
+
+func extractToSink(ctx context.Context, sink OutputSink, archive io.ReaderAt, outPath string, offset, size int64, opts CopyOptions) (int64, error) {
+	if err := checkBounds(archive, offset, size); err != nil {
+		return 0, fmt.Errorf("%s: %w", outPath, err)
+	}
+
+	w, err := sink.Create(outPath)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := copyRange(ctx, w, archive, offset, size, opts)
+	if err == nil {
+		err = opts.check()
+	}
+	if err != nil {
+		if a, ok := w.(aborter); ok {
+			a.Abort()
+		} else {
+			w.Close()
+		}
+		return n, fmt.Errorf("%s: %w", outPath, err)
+	}
+	if err := w.Close(); err != nil {
+		return n, fmt.Errorf("%s: %w", outPath, err)
+	}
+	return n, nil
+}
+
+// OutputSink is where extracted files are created.
+type OutputSink interface {
+	// Create opens path for writing, creating whatever parents it needs.
+	// The file is complete once the writer is closed. Writers may also
+	// have an Abort() error method, called instead of Close when the copy
+	// fails.
+	Create(path string) (io.WriteCloser, error)
+}
+
+type aborter interface {
+	Abort() error
+}
+
+// DiskSink creates files on the local file system.
+type DiskSink struct{}
+
+// Create implements OutputSink. The file is written under a temporary
+// name and only renamed to path by Close.
+func (DiskSink) Create(path string) (io.WriteCloser, error) {
+	// Make sure parent dir exists
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	// A name of its own, as entries sharing path may be written at once
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	// CreateTemp leaves the file readable only by its owner
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &diskFile{File: f, path: path}, nil
+}
+
+type diskFile struct {
+	*os.File
+	path string
+}
+
+func (f *diskFile) Close() error {
+	err := f.File.Close()
+	if err == nil {
+		err = os.Rename(f.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (f *diskFile) Abort() error {
+	f.File.Close()
+	return os.Remove(f.Name())
+}
+
+// ExtractTo is like ExtractFile but writes the entry to w.
+func ExtractTo(w io.Writer, archive io.ReaderAt, offset, size int64, opts CopyOptions) (int64, error) {
+	if err := checkBounds(archive, offset, size); err != nil {
+		return 0, err
+	}
+	n, err := copyRange(context.Background(), w, archive, offset, size, opts)
+	if err == nil {
+		err = opts.check()
+	}
+	return n, err
+}
+
+// copyRange copies the entry at offset to w. It fails with
+// io.ErrUnexpectedEOF if the archive ends before size bytes were read, and
+// with the error of ctx once it is done.
+func copyRange(ctx context.Context, w io.Writer, archive io.ReaderAt, offset, size int64, opts CopyOptions) (int64, error) {
+	var src io.Reader
+	if m, ok := archive.(*MappedArchive); ok {
+		// Bounds were checked by the caller
+		src = bytes.NewReader(m.data[offset : offset+size])
+	} else {
+		// SectionReader reads only the chunk we care about
+		src = io.NewSectionReader(archive, offset, size)
+	}
+	if opts.Sum != nil {
+		src = io.TeeReader(src, opts.Sum)
+	}
+	if ctx.Done() != nil {
+		src = &ctxReader{ctx: ctx, r: src}
+	}
+	counter := &countingReader{r: src}
+	src = counter
+	// Hide ReaderFrom so the copy goes through our buffer
+	w = struct{ io.Writer }{w}
+
+	buf := opts.buffer(size)
+	if !opts.Decompress || !isZlib(archive, offset, size) {
+		n, err := io.CopyBuffer(w, src, buf)
+		if err == nil && counter.n != size {
+			err = shortRead(counter.n, size)
+		}
+		return n, err
+	}
+
+	zr, err := zlib.NewReader(src)
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+
+	n, err := io.CopyBuffer(w, zr, buf)
+	if err != nil {
+		return n, err
+	}
+	// Let Sum see whatever follows the compressed stream
+	_, err = io.CopyBuffer(io.Discard, src, buf)
+	if err == nil && counter.n != size {
+		err = shortRead(counter.n, size)
+	}
+	return n, err
+}
+
+func shortRead(got, want int64) error {
+	return fmt.Errorf("read %d of %d bytes, archive truncated: %w", got, want, io.ErrUnexpectedEOF)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// isZlib reports whether the entry starts with a valid zlib header.
+func isZlib(archive io.ReaderAt, offset, size int64) bool {
+	if size < 2 {
+		return false
+	}
+	var head [2]byte
+	if _, err := archive.ReadAt(head[:], offset); err != nil {
+		return false
+	}
+	// Deflate with a window of at most 32K and a consistent check value
+	return head[0]&0x0F == 8 && head[0]>>4 <= 7 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0
+}
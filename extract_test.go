@@ -0,0 +1,287 @@
+package nfstools
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+var testHashList = HashList{
+	0x74377293: `AIRACELINES\A-L6R_AUTOBAHNDRIFT-1FED94BA.RCL`,
+	0xDEADBEEF: `..\..\escape.bin`,
+}
+
+// testArchives returns fake ZZDATA for testHeaders2003 with entries
+// aligned to 1<<shift bytes.
+func testArchives(shift uint) []io.ReaderAt {
+	align := 1 << shift
+	data0 := make([]byte, 2*align)
+	copy(data0, "known")
+	copy(data0[align:], "escape")
+	data1 := make([]byte, align)
+	copy(data1, "archive")
+	return []io.ReaderAt{bytes.NewReader(data0), bytes.NewReader(data1)}
+}
+
+func TestOutputPath(t *testing.T) {
+	known := Header{NameHash: 0x74377293, LocalOffset: 3}
+	unknown := Header{NameHash: 0x0000ABCD, LocalOffset: 0x1F}
+	escaping := Header{NameHash: 0xDEADBEEF}
+
+	tests := []struct {
+		name    string
+		opts    PathOptions
+		hdr     Header
+		want    string
+		wantErr error
+	}{
+		{"known", PathOptions{Root: "out"}, known, "out/AIRACELINES/A-L6R_AUTOBAHNDRIFT-1FED94BA.RCL", nil},
+		{"prefix", PathOptions{Root: "out", Prefix: "nfs"}, known, "out/nfs/AIRACELINES/A-L6R_AUTOBAHNDRIFT-1FED94BA.RCL", nil},
+		{"unknown", PathOptions{Root: "out"}, unknown, "out/__UNKNOWN__/0000ABCD", nil},
+		{"unknown by offset", PathOptions{Root: "out", UnknownName: NameByOffset}, unknown, "out/__UNKNOWN__/1F", nil},
+		{"unknown dir", PathOptions{Root: "out", UnknownDir: "misc"}, unknown, "out/misc/0000ABCD", nil},
+		{"unknown dir escaping", PathOptions{Root: "out", UnknownDir: "../../escaped"}, unknown, "", ErrUnknownDirEscapes},
+		{"unknown dir escaping prefix", PathOptions{Root: "out", Prefix: "nfs", UnknownDir: ".."}, known, "", ErrUnknownDirEscapes},
+		{"escaping", PathOptions{Root: "out"}, escaping, "out/__UNKNOWN__/DEADBEEF", ErrPathTraversal},
+		{"strip", PathOptions{Root: "out", StripComponents: 1}, known, "out/A-L6R_AUTOBAHNDRIFT-1FED94BA.RCL", nil},
+		{"strip all", PathOptions{Root: "out", StripComponents: 2}, known, "", ErrNameStripped},
+		{"lower", PathOptions{Root: "out", Lower: true}, known, "out/airacelines/a-l6r_autobahndrift-1fed94ba.rcl", nil},
+		{"flatten", PathOptions{Root: "out", Flatten: true}, known, "out/A-L6R_AUTOBAHNDRIFT-1FED94BA.RCL", nil},
+	}
+	for _, tt := range tests {
+		got, err := tt.opts.OutputPath(testHashList, tt.hdr)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if got != filepath.FromSlash(tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, filepath.FromSlash(tt.want))
+		}
+	}
+}
+
+func TestBuildOutputPathSanitizes(t *testing.T) {
+	hashList := HashList{1: "BAD\x01NAME"}
+	got, err := BuildOutputPath("out", hashList, Header{NameHash: 1})
+	if !errors.Is(err, ErrNameSanitized) {
+		t.Errorf("error %v, want ErrNameSanitized", err)
+	}
+	if want := filepath.Join("out", "BAD_NAME"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestExtractTo(t *testing.T) {
+	const shift = 4
+	archives := testArchives(shift)
+	for _, hdr := range testHeaders2003 {
+		offset, err := ResolveOffset(hdr, shift)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		n, err := ExtractTo(&buf, archives[hdr.ArchiveID], offset, int64(hdr.Size), CopyOptions{})
+		if err != nil {
+			t.Errorf("%08X: %v", hdr.NameHash, err)
+			continue
+		}
+		if n != int64(hdr.Size) || buf.Len() != int(hdr.Size) {
+			t.Errorf("%08X: wrote %d bytes, want %d", hdr.NameHash, n, hdr.Size)
+		}
+	}
+}
+
+func TestExtractFile(t *testing.T) {
+	const shift = 4
+	hdr := testHeaders2003[1]
+	offset, err := ResolveOffset(hdr, shift)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(t.TempDir(), "dir", "entry")
+	if _, err := ExtractFile(testArchives(shift)[0], outPath, offset, int64(hdr.Size), CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "escape" {
+		t.Errorf("got %q, want %q", got, "escape")
+	}
+	if left, _ := filepath.Glob(outPath + ".*.tmp"); len(left) > 0 {
+		t.Errorf("temporary file left behind: %s", left[0])
+	}
+}
+
+// TestExtractFileSamePath writes entries resolving to the same path at
+// once, as happens when names collide.
+func TestExtractFileSamePath(t *testing.T) {
+	archive := bytes.NewReader(bytes.Repeat([]byte("data"), 1<<12))
+	outPath := filepath.Join(t.TempDir(), "entry")
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			if _, err := ExtractFile(archive, outPath, 0, archive.Size(), CopyOptions{}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+	if left, _ := filepath.Glob(outPath + ".*.tmp"); len(left) > 0 {
+		t.Errorf("temporary file left behind: %s", left[0])
+	}
+}
+
+func TestExtractFileCheckFails(t *testing.T) {
+	outPath := filepath.Join(t.TempDir(), "entry")
+	opts := CopyOptions{Check: func() error { return ErrChecksumMismatch }}
+	_, err := ExtractFile(bytes.NewReader([]byte("data")), outPath, 0, 4, opts)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("got %v, want ErrChecksumMismatch", err)
+	}
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		t.Errorf("file written despite the failed check: %v", err)
+	}
+}
+
+func TestExtractToOutOfBounds(t *testing.T) {
+	archive := bytes.NewReader(make([]byte, 16))
+	tests := []struct {
+		name         string
+		offset, size int64
+	}{
+		{"past the end", 16, 1},
+		{"overlapping the end", 10, 7},
+		{"negative offset", -1, 1},
+	}
+	for _, tt := range tests {
+		if _, err := ExtractTo(io.Discard, archive, tt.offset, tt.size, CopyOptions{}); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
+
+func TestExtractAll(t *testing.T) {
+	want := map[string][]byte{
+		"AIRACELINES/A-L6R_AUTOBAHNDRIFT-1FED94BA.RCL": []byte("known"),
+		"__UNKNOWN__/DEADBEEF":                         []byte("escape"),
+		"__UNKNOWN__/12345678":                         []byte("archive"),
+	}
+	tests := []struct {
+		name      string
+		dataShift uint // alignment the archives were written with
+		shift     uint
+		wantErr   bool
+	}{
+		{"small alignment", 4, 4, false},
+		{"default alignment", OffsetShift, OffsetShift, false},
+		{"wrong shift", 4, OffsetShift, true},
+	}
+	for _, tt := range tests {
+		got, err := ExtractAll(testHeaders2003, testHashList, testArchives(tt.dataShift), tt.shift)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: no error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !maps.EqualFunc(got, want, bytes.Equal) {
+			t.Errorf("%s: got files %q, want %q", tt.name, slices.Sorted(maps.Keys(got)), slices.Sorted(maps.Keys(want)))
+		}
+	}
+}
+
+func TestExtractAllMissingArchive(t *testing.T) {
+	_, err := ExtractAll(testHeaders2003, testHashList, testArchives(4)[:1], 4)
+	if !errors.Is(err, ErrArchiveIndexOutOfRange) {
+		t.Errorf("got %v, want ErrArchiveIndexOutOfRange", err)
+	}
+}
+
+// bigArchive pretends to be an archive of size bytes, where the byte at
+// every offset is derived from the offset itself.
+type bigArchive struct {
+	size int64
+}
+
+func (a bigArchive) Size() int64 { return a.size }
+
+func (a bigArchive) ReadAt(p []byte, off int64) (int, error) {
+	if off >= a.size {
+		return 0, io.EOF
+	}
+	n := int(min(int64(len(p)), a.size-off))
+	for i := range n {
+		p[i] = bigArchiveByte(off + int64(i))
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func bigArchiveByte(off int64) byte {
+	return byte(off ^ off>>8 ^ off>>32)
+}
+
+// TestExtractLargeOffset reads entries beyond what a 32 bit int holds,
+// which also has to work on 32 bit platforms.
+func TestExtractLargeOffset(t *testing.T) {
+	archive := bigArchive{size: 5 << 30}
+	tests := []struct {
+		name    string
+		hdr     Header
+		wantErr bool
+	}{
+		{"past 2 GiB", Header{NameHash: 1, LocalOffset: (2<<30 + 1<<20) >> OffsetShift, Size: 64}, false},
+		{"past 4 GiB", Header{NameHash: 2, LocalOffset: (4<<30 + 1<<20) >> OffsetShift, Size: 64}, false},
+		{"ending at the end", Header{NameHash: 3, LocalOffset: (5<<30 - 1<<OffsetShift) >> OffsetShift, Size: 1 << OffsetShift}, false},
+		{"past the end", Header{NameHash: 4, LocalOffset: 5 << 30 >> OffsetShift, Size: 1}, true},
+	}
+	for _, tt := range tests {
+		offset, err := ResolveOffset(tt.hdr, OffsetShift)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var buf bytes.Buffer
+		n, err := ExtractTo(&buf, archive, offset, int64(tt.hdr.Size), CopyOptions{})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: no error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if n != int64(tt.hdr.Size) {
+			t.Errorf("%s: wrote %d bytes, want %d", tt.name, n, tt.hdr.Size)
+		}
+		for i, b := range buf.Bytes() {
+			if want := bigArchiveByte(offset + int64(i)); b != want {
+				t.Errorf("%s: byte %d is %#x, want %#x", tt.name, i, b, want)
+				break
+			}
+		}
+	}
+
+	files, err := ExtractAll([]Header{tests[1].hdr}, nil, []io.ReaderAt{archive}, OffsetShift)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(files["__UNKNOWN__/00000002"]); got != 64 {
+		t.Errorf("ExtractAll wrote %d bytes, want 64", got)
+	}
+}
@@ -0,0 +1,205 @@
+package nfstools
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ArchiveFS is a read-only fs.FS over the entries of a ZDIR. Names come
+// from the hash list, unknown entries appear below UnknownDir named by
+// NameByHash.
+type ArchiveFS struct {
+	archives []io.ReaderAt
+	shift    uint
+	root     *fsNode
+}
+
+type fsNode struct {
+	name     string
+	hdr      Header
+	children map[string]*fsNode // nil for files
+}
+
+// NewArchiveFS builds the directory tree for headers. Entries whose
+// ArchiveID has no matching archive fail when opened.
+func NewArchiveFS(headers []Header, hashList HashList, archives []io.ReaderAt, shift uint) *ArchiveFS {
+	fsys := &ArchiveFS{
+		archives: archives,
+		shift:    shift,
+		root:     &fsNode{name: ".", children: make(map[string]*fsNode)},
+	}
+	for _, hdr := range headers {
+		name, ok := hashList[hdr.NameHash]
+		name = strings.ReplaceAll(name, `\`, "/")
+		if !ok || !fs.ValidPath(name) || name == "." {
+			name = path.Join(UnknownDir, NameByHash(hdr))
+		}
+		fsys.add(name, hdr)
+	}
+	return fsys
+}
+
+// add inserts a file, keeping the first entry when paths clash.
+func (fsys *ArchiveFS) add(name string, hdr Header) {
+	dir := fsys.root
+	elems := strings.Split(name, "/")
+	for _, elem := range elems[:len(elems)-1] {
+		child, ok := dir.children[elem]
+		if !ok {
+			child = &fsNode{name: elem, children: make(map[string]*fsNode)}
+			dir.children[elem] = child
+		}
+		if child.children == nil {
+			return
+		}
+		dir = child
+	}
+
+	base := elems[len(elems)-1]
+	if _, ok := dir.children[base]; !ok {
+		dir.children[base] = &fsNode{name: base, hdr: hdr}
+	}
+}
+
+func (fsys *ArchiveFS) lookup(op, name string) (*fsNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	node := fsys.root
+	if name == "." {
+		return node, nil
+	}
+	for _, elem := range strings.Split(name, "/") {
+		child, ok := node.children[elem]
+		if !ok {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		node = child
+	}
+	return node, nil
+}
+
+// Open implements fs.FS.
+func (fsys *ArchiveFS) Open(name string) (fs.File, error) {
+	node, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if node.children != nil {
+		return &fsDirFile{node: node}, nil
+	}
+
+	hdr := node.hdr
+	if uint(hdr.ArchiveID) >= uint(len(fsys.archives)) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("%w: archive %d not available", ErrArchiveIndexOutOfRange, hdr.ArchiveID)}
+	}
+	offset, err := ResolveOffset(hdr, fsys.shift)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	archive := fsys.archives[hdr.ArchiveID]
+	if err := checkBounds(archive, offset, int64(hdr.Size)); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &fsFile{
+		SectionReader: io.NewSectionReader(archive, offset, int64(hdr.Size)),
+		node:          node,
+	}, nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (fsys *ArchiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	node, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if node.children == nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return node.entries(), nil
+}
+
+func (n *fsNode) entries() []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(n.children))
+	for _, child := range n.children {
+		entries = append(entries, fs.FileInfoToDirEntry(fsInfo{child}))
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries
+}
+
+// fsInfo implements fs.FileInfo for a node.
+type fsInfo struct {
+	node *fsNode
+}
+
+func (fi fsInfo) Name() string       { return fi.node.name }
+func (fi fsInfo) ModTime() time.Time { return time.Time{} }
+func (fi fsInfo) IsDir() bool        { return fi.node.children != nil }
+func (fi fsInfo) Sys() any           { return nil }
+
+func (fi fsInfo) Size() int64 {
+	if fi.IsDir() {
+		return 0
+	}
+	return int64(fi.node.hdr.Size)
+}
+
+func (fi fsInfo) Mode() fs.FileMode {
+	if fi.IsDir() {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+type fsFile struct {
+	*io.SectionReader
+	node *fsNode
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return fsInfo{f.node}, nil }
+func (f *fsFile) Close() error               { return nil }
+
+type fsDirFile struct {
+	node    *fsNode
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *fsDirFile) Stat() (fs.FileInfo, error) { return fsInfo{d.node}, nil }
+func (d *fsDirFile) Close() error               { return nil }
+
+func (d *fsDirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.node.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *fsDirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		d.entries = d.node.entries()
+		d.read = true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,244 @@
+package nfstools
+
+import (
+	"bufio"
+	_ "embed"
+	"io"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// HashList maps a file name hash back to the name it was computed from.
+type HashList map[uint32]string
+
+//go:embed files.list
+var embeddedFileList string
+
+// Collision describes two distinct names that share a hash.
+type Collision struct {
+	Hash     uint32
+	Existing string
+	Name     string
+}
+
+// EmbeddedHashList returns the hash list built from the bundled files.list
+// with DefaultHasher.
+func EmbeddedHashList() HashList {
+	hashList := make(HashList)
+	hashList.LoadEmbedded()
+	return hashList
+}
+
+// EmbeddedNames returns the raw lines of the bundled files.list.
+func EmbeddedNames() []string {
+	var names []string
+	scanner := bufio.NewScanner(strings.NewReader(embeddedFileList))
+	for scanner.Scan() {
+		names = append(names, scanner.Text())
+	}
+	return names
+}
+
+// LoadHashList builds a hash list from newline separated file names with
+// DefaultHasher.
+func LoadHashList(r io.Reader) (HashList, error) {
+	return DefaultHasher.LoadHashList(r)
+}
+
+// LoadEmbedded adds the bundled files.list to h with DefaultHasher.
+func (h HashList) LoadEmbedded() []Collision {
+	return DefaultHasher.LoadEmbedded(h)
+}
+
+// Load adds newline separated file names from r to h, hashed with
+// DefaultHasher. See Hasher.Load.
+func (h HashList) Load(r io.Reader) ([]Collision, error) {
+	return DefaultHasher.Load(h, r)
+}
+
+// LoadHashList builds a hash list from newline separated file names.
+func (h Hasher) LoadHashList(r io.Reader) (HashList, error) {
+	hashList := make(HashList)
+	_, err := h.Load(hashList, r)
+	return hashList, err
+}
+
+// LoadEmbedded adds the bundled files.list to hashList.
+func (h Hasher) LoadEmbedded(hashList HashList) []Collision {
+	// Reading from a string never fails
+	collisions, _ := h.Load(hashList, strings.NewReader(embeddedFileList))
+	return collisions
+}
+
+// Load adds newline separated file names from r to hashList, replacing
+// names that share a hash. Every replaced name that differs from its
+// replacement is reported as a collision. Surrounding white space is
+// trimmed, blank lines and lines starting with # are skipped.
+func (h Hasher) Load(hashList HashList, r io.Reader) ([]Collision, error) {
+	var names []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	// Names are added in file order whichever way they were hashed
+	var collisions []Collision
+	for i, hash := range h.hashNames(names) {
+		name := names[i]
+		if existing, ok := hashList[hash]; ok && !h.Same(existing, name) {
+			collisions = append(collisions, Collision{Hash: hash, Existing: existing, Name: name})
+		}
+		hashList[hash] = name
+	}
+	return collisions, scanner.Err()
+}
+
+// parallelHashThreshold is the number of names from which hashNames
+// spreads the work over every CPU.
+const parallelHashThreshold = 1 << 16
+
+// hashNames returns the hash of every name, in the same order.
+func (h Hasher) hashNames(names []string) []uint32 {
+	hashes := make([]uint32, len(names))
+	workers := runtime.GOMAXPROCS(0)
+	if len(names) < parallelHashThreshold || workers == 1 {
+		for i, name := range names {
+			hashes[i] = h.Hash(name)
+		}
+		return hashes
+	}
+
+	var wg sync.WaitGroup
+	chunk := (len(names) + workers - 1) / workers
+	for start := 0; start < len(names); start += chunk {
+		end := min(start+chunk, len(names))
+		wg.Go(func() {
+			for i := start; i < end; i++ {
+				hashes[i] = h.Hash(names[i])
+			}
+		})
+	}
+	wg.Wait()
+	return hashes
+}
+
+// Alternatives groups the names in collisions by hash, in the order they
+// were loaded, telling names apart like DefaultHasher.
+func Alternatives(collisions []Collision) map[uint32][]string {
+	return DefaultHasher.Alternatives(collisions)
+}
+
+// Alternatives groups the names in collisions by hash, in the order they
+// were loaded. A HashList holds only one of them, the last loaded.
+func (h Hasher) Alternatives(collisions []Collision) map[uint32][]string {
+	alts := make(map[uint32][]string)
+	for _, c := range collisions {
+		names := alts[c.Hash]
+		for _, name := range []string{c.Existing, c.Name} {
+			if !slices.ContainsFunc(names, func(n string) bool { return h.Same(n, name) }) {
+				names = append(names, name)
+			}
+		}
+		alts[c.Hash] = names
+	}
+	return alts
+}
+
+// Name returns the name hash was computed from, if h knows it.
+func (h HashList) Name(hash uint32) (string, bool) {
+	name, ok := h[hash]
+	return name, ok
+}
+
+// Merge copies every entry of other into h, replacing names that share
+// a hash.
+func (h HashList) Merge(other HashList) {
+	for hash, name := range other {
+		h[hash] = name
+	}
+}
+
+// HashName returns the hash the games use to look up name, computed by
+// DefaultHasher.
+func HashName(name string) uint32 {
+	return DefaultHasher.Hash(name)
+}
+
+// HashOp is how a hash step folds in the next byte of a name.
+type HashOp int
+
+const (
+	HashAdd HashOp = iota // hash = 33*hash + c
+	HashXor               // hash = 33*hash ^ c
+)
+
+// DefaultSeed is the initial hash value of the games supported so far.
+const DefaultSeed = 0xFFFFFFFF
+
+// Hasher computes the file name hashes stored in ZDIR records.
+type Hasher struct {
+	// Raw hashes names byte for byte instead of normalizing them first.
+	Raw bool
+
+	// Seed is the hash of the empty name. Unlike the other fields its zero
+	// value is not the default, which is DefaultSeed.
+	Seed uint32
+
+	// Op selects the step applied for every byte.
+	Op HashOp
+}
+
+// DefaultHasher hashes names like the games supported so far. HashName and
+// the loaders that take no Hasher use it.
+var DefaultHasher = Hasher{Seed: DefaultSeed}
+
+// Hash returns the hash of name.
+func (h Hasher) Hash(name string) uint32 {
+	if !h.Raw {
+		name = NormalizeName(name)
+	}
+	return getFileNameHash(name, h.Seed, h.Op)
+}
+
+// Same reports whether a and b hash as the same name.
+func (h Hasher) Same(a, b string) bool {
+	if h.Raw {
+		return a == b
+	}
+	return NormalizeName(a) == NormalizeName(b)
+}
+
+// NormalizeName converts name to the form the games hash: ASCII upper
+// case with backslash separators.
+func NormalizeName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		switch {
+		case 'a' <= c && c <= 'z':
+			b[i] = c - 'a' + 'A'
+		case c == '/':
+			b[i] = '\\'
+		}
+	}
+	return string(b)
+}
+
+func getFileNameHash(name string, seed uint32, op HashOp) uint32 {
+	hash := seed
+	if op == HashXor {
+		for i := range len(name) {
+			hash = 33*hash ^ uint32(name[i])
+		}
+		return hash
+	}
+	for i := range len(name) {
+		hash = 33*hash + uint32(name[i])
+	}
+	return hash
+}
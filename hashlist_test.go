@@ -0,0 +1,97 @@
+package nfstools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashName(t *testing.T) {
+	tests := []struct {
+		name string
+		want uint32
+	}{
+		{"", 0xFFFFFFFF},
+		{"A", 0x00000020},
+		{`GLOBAL\GLOBALB.BUN`, 0x4C937012},
+		{`AIRACELINES\A-L6R_AUTOBAHNDRIFT-1FED94BA.RCL`, 0x74377293},
+	}
+	for _, tt := range tests {
+		if got := HashName(tt.name); got != tt.want {
+			t.Errorf("HashName(%q) = %08X, want %08X", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHashNormalization(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  bool
+		want uint32
+	}{
+		{`AIRACELINES\A-L6R_AUTOBAHNDRIFT-1FED94BA.RCL`, false, 0x74377293},
+		{`airacelines\a-l6r_autobahndrift-1fed94ba.rcl`, false, 0x74377293},
+		{`AIRACELINES/A-L6R_AUTOBAHNDRIFT-1FED94BA.RCL`, false, 0x74377293},
+		{`airacelines/a-l6r_autobahndrift-1fed94ba.rcl`, false, 0x74377293},
+		{`AIRACELINES\A-L6R_AUTOBAHNDRIFT-1FED94BA.RCL`, true, 0x74377293},
+		{`airacelines\a-l6r_autobahndrift-1fed94ba.rcl`, true, 0xFE80D2F3},
+		{`AIRACELINES/A-L6R_AUTOBAHNDRIFT-1FED94BA.RCL`, true, 0x6D69FE66},
+		{`airacelines/a-l6r_autobahndrift-1fed94ba.rcl`, true, 0xF7B35EC6},
+	}
+	for _, tt := range tests {
+		hasher := Hasher{Raw: tt.raw, Seed: DefaultSeed}
+		if got := hasher.Hash(tt.name); got != tt.want {
+			t.Errorf("raw %t: Hash(%q) = %08X, want %08X", tt.raw, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{`global/globalb.bun`, `GLOBAL\GLOBALB.BUN`},
+		{`Cars\Tex_01.fsh`, `CARS\TEX_01.FSH`},
+		{"caf\u00e9", "CAF\u00e9"}, // only ASCII letters change
+	}
+	for _, tt := range tests {
+		if got := NormalizeName(tt.name); got != tt.want {
+			t.Errorf("NormalizeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHasherVariants(t *testing.T) {
+	const name = `GLOBAL\GLOBALB.BUN`
+	tests := []struct {
+		variant string
+		hasher  Hasher
+		want    uint32
+	}{
+		{"nfs", Hasher{Seed: DefaultSeed, Op: HashAdd}, 0x4C937012},
+		{"djb2", Hasher{Seed: 5381, Op: HashAdd}, 0x5C152A98},
+		{"djb2a", Hasher{Seed: 5381, Op: HashXor}, 0x19A233AC},
+	}
+	for _, tt := range tests {
+		if got := tt.hasher.Hash(name); got != tt.want {
+			t.Errorf("%s: Hash(%q) = %08X, want %08X", tt.variant, name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadHashList(t *testing.T) {
+	hashList, err := LoadHashList(strings.NewReader("# comment\n\n  GLOBAL\\GLOBALB.BUN  \r\nA\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashList) != 2 {
+		t.Errorf("got %d names, want 2", len(hashList))
+	}
+	if name, ok := hashList.Name(0x4C937012); !ok || name != `GLOBAL\GLOBALB.BUN` {
+		t.Errorf("Name(4C937012) = %q, %t", name, ok)
+	}
+}
+
+func TestEmbeddedHashList(t *testing.T) {
+	name, ok := EmbeddedHashList().Name(0x74377293)
+	if want := `AIRACELINES\A-L6R_AUTOBAHNDRIFT-1FED94BA.RCL`; !ok || name != want {
+		t.Errorf("Name(74377293) = %q, %t, want %q", name, ok, want)
+	}
+}
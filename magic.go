@@ -0,0 +1,42 @@
+package nfstools
+
+import (
+	"io"
+	"strings"
+)
+
+// MagicExtensions maps well known leading bytes to the extension used for
+// files starting with them. Contributors can add entries as new formats
+// are identified.
+var MagicExtensions = map[string]string{
+	"DDS ":             ".dds",
+	"RIFF":             ".wav",
+	"SCHl":             ".asf",
+	"SHPI":             ".fsh",
+	"BIGF":             ".big",
+	"\x89PNG":          ".png",
+	"\x00\x00\x30\xB3": ".tpk", // bChunk texture pack
+}
+
+// magicLen is the number of leading bytes GuessExt needs to see.
+const magicLen = 16
+
+// GuessExt returns the extension of the longest MagicExtensions prefix of
+// head, or "" when nothing matches.
+func GuessExt(head []byte) string {
+	var ext string
+	var best int
+	for magic, e := range MagicExtensions {
+		if len(magic) > best && strings.HasPrefix(string(head), magic) {
+			ext, best = e, len(magic)
+		}
+	}
+	return ext
+}
+
+// PeekExt reads the start of an entry and guesses its extension.
+func PeekExt(archive io.ReaderAt, offset, size int64) string {
+	head := make([]byte, min(size, magicLen))
+	n, _ := archive.ReadAt(head, offset)
+	return GuessExt(head[:n])
+}
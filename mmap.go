@@ -0,0 +1,27 @@
+package nfstools
+
+import (
+	"io"
+)
+
+// MappedArchive serves reads straight from an archive mapped into memory.
+type MappedArchive struct {
+	data []byte
+}
+
+// ReadAt implements io.ReaderAt.
+func (m *MappedArchive) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off > int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Size returns the length of the mapping.
+func (m *MappedArchive) Size() int64 {
+	return int64(len(m.data))
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package nfstools
+
+import (
+	"errors"
+	"os"
+)
+
+// MapArchive is not supported on this platform, callers should read from
+// the file instead.
+func MapArchive(f *os.File) (*MappedArchive, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// Close releases the mapping.
+func (m *MappedArchive) Close() error {
+	return nil
+}
@@ -0,0 +1,41 @@
+//go:build unix
+
+package nfstools
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"syscall"
+)
+
+// MapArchive maps f read-only into memory. The mapping stays valid after
+// f is closed, until Close is called.
+func MapArchive(f *os.File) (*MappedArchive, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return &MappedArchive{}, nil
+	}
+	if info.Size() > math.MaxInt {
+		return nil, fmt.Errorf("%s: too large to map", f.Name())
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	return &MappedArchive{data: data}, nil
+}
+
+// Close releases the mapping.
+func (m *MappedArchive) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	data := m.data
+	m.data = nil
+	return syscall.Munmap(data)
+}
@@ -1,20 +1,42 @@
-package main
+// Package nfstools reads the ZDIR/ZZDATA archives used by the Need for
+// Speed games and extracts their contents.
+package nfstools
 
 import (
 	"bufio"
-	_ "embed"
 	"encoding/binary"
 	"fmt"
 	"io"
-	"path/filepath"
-
-	// "io/fs"
+	"iter"
+	"math"
 	"os"
-	"path"
-	"strings"
 )
 
-type hlist = map[uint32]string
+type Format int
+
+const (
+	FormatUnknown Format = iota
+	Format2002
+	Format2003
+)
+
+const (
+	ExtractedRoot = "EXTRACTED"
+	UnknownDir    = "__UNKNOWN__"
+	OffsetShift   = 11 // default alignment of entries in ZZDATA
+	bufferSize    = 32 * 1024
+)
+
+// Header is the format independent view of a directory record. For
+// ZDIR2002 records ArchiveID and Checksum are always zero.
+type Header struct {
+	NameHash    uint32
+	ArchiveID   uint32
+	LocalOffset uint32
+	TotalOffset uint32
+	Size        uint32
+	Checksum    uint32
+}
 
 type zdir2002 struct {
 	NameHash    uint32
@@ -22,112 +44,219 @@ type zdir2002 struct {
 	Size        uint32
 }
 
-//go:embed files.list
-var fileList string
+type zdir2003 struct {
+	NameHash    uint32
+	ArchiveID   uint32
+	LocalOffset uint32
+	TotalOffset uint32
+	Size        uint32
+	Checksum    uint32
+}
 
-func main() {
-	argc := len(os.Args)
-	if argc < 3 {
-		printHelp()
-	}
+type record interface {
+	zdir2002 | zdir2003
+	header() Header
+}
 
-	headers, err := loadHeaders(os.Args[1])
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to load headers: %v\n", err)
-		os.Exit(1)
+func (z zdir2002) header() Header {
+	return Header{
+		NameHash:    z.NameHash,
+		LocalOffset: z.LocalOffset,
+		TotalOffset: z.LocalOffset,
+		Size:        z.Size,
 	}
+}
 
-	var outPath string
-	hashList := loadHashList(&fileList)
-	for _, header := range headers {
-		name, ok := hashList[header.NameHash]
-		normalized := filepath.FromSlash(strings.ReplaceAll(name, `\`, `/`))
+func (z zdir2003) header() Header {
+	return Header(z)
+}
 
-		if ok {
-			outPath = path.Join("EXTRACTED", normalized)
-		} else {
-			outPath = path.Join("EXTRACTED", "__UNKNOWN__", fmt.Sprintf("%X", header.LocalOffset))
-		}
-		err := extractFile(os.Args[2], outPath, int64(header.LocalOffset<<11), int64(header.Size))
-		fmt.Println(outPath)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
-		}
+// ParseFormat parses "2002" or "2003".
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "2002":
+		return Format2002, nil
+	case "2003":
+		return Format2003, nil
 	}
-
-	os.Exit(0)
+	return FormatUnknown, fmt.Errorf("unknown ZDIR format %q", s)
 }
 
-func extractFile(archivePath, outPath string, offset, size int64) error {
-	archive, err := os.Open(archivePath)
-	if err != nil {
-		return err
+func (f Format) String() string {
+	switch f {
+	case Format2002:
+		return "2002"
+	case Format2003:
+		return "2003"
 	}
-	defer archive.Close()
+	return "unknown"
+}
 
-	// Make sure parent dir exists
-	if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
-		return err
+// ResolveOffset returns the byte offset of hdr inside its archive, with
+// LocalOffset counted in units of 1<<shift bytes.
+func ResolveOffset(hdr Header, shift uint) (int64, error) {
+	if shift >= 63 || int64(hdr.LocalOffset) > math.MaxInt64>>shift {
+		return 0, fmt.Errorf("entry %08X: offset %X overflows when shifted by %d", hdr.NameHash, hdr.LocalOffset, shift)
 	}
+	return int64(hdr.LocalOffset) << shift, nil
+}
 
-	outFile, err := os.Create(outPath)
-	if err != nil {
-		return err
-	}
-	defer outFile.Close()
+// IsAmbiguous reports whether a directory of size bytes could hold either
+// record layout. DetectFormat has to look at the records to choose.
+func IsAmbiguous(size int64) bool {
+	return size > 0 && size%24 == 0
+}
 
-	// SectionReader reads only the chunk we care about
-	section := io.NewSectionReader(archive, offset, size)
+// SniffLen is how much of a directory DetectFormat looks at.
+const SniffLen = 64 * 24
 
-	// Optional: use a custom buffer size
-	buf := make([]byte, 32*1024) // 32 KB chunks
-	_, err = io.CopyBuffer(outFile, section, buf)
-	return err
-}
+// Limits of what real directories hold, used to tell the layouts apart
+const (
+	maxArchives    = 64
+	maxEntrySize   = 1 << 30
+	maxTotalOffset = 1 << 24 // 32 GiB at the default offset shift
+)
 
-func printHelp() {
-	fmt.Printf("Usage: %s <ZDIR> <ZZDATA>\n", path.Base(os.Args[0]))
-	os.Exit(1)
-}
+// DetectFormat guesses the record layout of a directory of size bytes that
+// starts with head, ideally SniffLen bytes of it. When the size fits both
+// layouts, the first records are read both ways, in the given byte order,
+// and the layout under which they look like real entries wins. sure is
+// false when that does not settle it, in which case ZDIR2003 is assumed.
+func DetectFormat(head []byte, size int64, order binary.ByteOrder) (format Format, sure bool) {
+	if !IsAmbiguous(size) {
+		format = detectZdirType(size)
+		return format, format != FormatUnknown
+	}
 
-func loadHashList(list *string) hlist {
-	hashList := make(hlist)
-	reader := strings.NewReader(*list)
-	scanner := bufio.NewScanner(reader)
+	plausible2002, plausible2003 := true, true
+	for i := 0; i+24 <= len(head); i += 24 {
+		field := func(n int) uint32 { return order.Uint32(head[i+4*n:]) }
+		// As two ZDIR2002 records, the sizes must be sane
+		if field(2) > maxEntrySize || field(5) > maxEntrySize {
+			plausible2002 = false
+		}
+		// As one ZDIR2003 record, archives are few, sizes sane and the
+		// total offset at least the local one
+		if field(1) >= maxArchives || field(3) < field(2) || field(3) > maxTotalOffset || field(4) > maxEntrySize {
+			plausible2003 = false
+		}
+	}
 
-	for scanner.Scan() {
-		name := scanner.Text()
-		hash := getFileNamehash(&name)
-		hashList[hash] = name
+	switch {
+	case plausible2002 && !plausible2003:
+		return Format2002, true
+	case plausible2003 && !plausible2002:
+		return Format2003, true
 	}
-	return hashList
+	return Format2003, false
 }
 
-func getFileNamehash(name *string) uint32 {
-	hash := uint32(0xFFFFFFFF)
-	for i := range len(*name) {
-		hash = 33*hash + uint32(rune((*name)[i]))
+// detectZdirType guesses the record layout from the directory size.
+func detectZdirType(size int64) Format {
+	switch {
+	case size%24 == 0:
+		return Format2003
+	case size%12 == 0:
+		return Format2002
 	}
-	return hash
+	return FormatUnknown
 }
 
-func loadHeaders(name string) ([]zdir2002, error) {
+// LoadHeaders reads every record of the ZDIR file at name, stored in the
+// given byte order. PC releases store them binary.LittleEndian, console
+// releases binary.BigEndian. The format is detected when format is
+// FormatUnknown.
+func LoadHeaders(name string, format Format, order binary.ByteOrder) ([]Header, Format, error) {
 	f, err := os.Open(name)
 	if err != nil {
-		return nil, err
+		return nil, FormatUnknown, err
 	}
 	defer f.Close()
 
-	fInfo, err := f.Stat()
+	info, err := f.Stat()
 	if err != nil {
-		return nil, err
+		return nil, FormatUnknown, err
+	}
+	return ReadHeaders(f, info.Size(), format, order)
+}
+
+// ReadHeaders reads every record of a ZDIR that is size bytes long, like
+// LoadHeaders. The format is detected by DetectFormat when unknown.
+func ReadHeaders(r io.Reader, size int64, format Format, order binary.ByteOrder) ([]Header, Format, error) {
+	var headers []Header
+	var err error
+	if format == FormatUnknown {
+		br := bufio.NewReaderSize(r, SniffLen)
+		head, _ := br.Peek(int(min(size, SniffLen)))
+		format, _ = DetectFormat(head, size, order)
+		r = br
 	}
+	switch format {
+	case Format2002:
+		headers, err = loadRecords[zdir2002](r, size, order)
+	case Format2003:
+		headers, err = loadRecords[zdir2003](r, size, order)
+	default:
+		err = fmt.Errorf("%w: %d bytes fits no record layout", ErrInvalidZDIRSize, size)
+	}
+	return headers, format, err
+}
 
-	headers := make([]zdir2002, fInfo.Size()/12)
-	if err := binary.Read(f, binary.LittleEndian, &headers); err != nil {
+// Entries reads the records of a ZDIR from r one at a time, without
+// holding the whole directory in memory. Unlike ReadHeaders it needs to be
+// told the format. Iteration stops after the first error, which includes a
+// directory ending in a partial record.
+func Entries(r io.Reader, format Format, order binary.ByteOrder) iter.Seq2[Header, error] {
+	switch format {
+	case Format2002:
+		return entries[zdir2002](r, order)
+	case Format2003:
+		return entries[zdir2003](r, order)
+	}
+	return func(yield func(Header, error) bool) {
+		yield(Header{}, fmt.Errorf("cannot stream a directory of format %s", format))
+	}
+}
+
+func entries[T record](r io.Reader, order binary.ByteOrder) iter.Seq2[Header, error] {
+	return func(yield func(Header, error) bool) {
+		br := bufio.NewReader(r)
+		for i := 0; ; i++ {
+			var rec T
+			err := binary.Read(br, order, &rec)
+			switch {
+			case err == io.EOF:
+				return
+			case err == io.ErrUnexpectedEOF:
+				err = fmt.Errorf("%w: record %d is incomplete", ErrInvalidZDIRSize, i)
+			}
+			if err != nil {
+				yield(Header{}, err)
+				return
+			}
+			if !yield(rec.header(), nil) {
+				return
+			}
+		}
+	}
+}
+
+// loadRecords reads size bytes of T records in the given byte order, sized
+// by their binary layout, and converts them to headers.
+func loadRecords[T record](r io.Reader, size int64, order binary.ByteOrder) ([]Header, error) {
+	recSize := int64(binary.Size(new(T)))
+	if size%recSize != 0 {
+		return nil, fmt.Errorf("%w: %d bytes is not a multiple of %d", ErrInvalidZDIRSize, size, recSize)
+	}
+
+	records := make([]T, size/recSize)
+	if err := binary.Read(r, order, records); err != nil {
 		return nil, err
 	}
 
+	headers := make([]Header, len(records))
+	for i, rec := range records {
+		headers[i] = rec.header()
+	}
 	return headers, nil
 }
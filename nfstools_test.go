@@ -0,0 +1,215 @@
+package nfstools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// Entries of the test directory, as both layouts store them. ZDIR2002
+// keeps no archive or checksum so those stay zero.
+var (
+	testHeaders2002 = []Header{
+		{NameHash: 0x74377293, LocalOffset: 0, TotalOffset: 0, Size: 5},
+		{NameHash: 0xDEADBEEF, LocalOffset: 1, TotalOffset: 1, Size: 6},
+		{NameHash: 0x12345678, LocalOffset: 3, TotalOffset: 3, Size: 0},
+	}
+	// An even number of records, so the directory size fits both layouts
+	testHeaders2002Even = []Header{
+		{NameHash: 0x74377293, LocalOffset: 0, TotalOffset: 0, Size: 5},
+		{NameHash: 0xDEADBEEF, LocalOffset: 1, TotalOffset: 1, Size: 6},
+		{NameHash: 0x12345678, LocalOffset: 3, TotalOffset: 3, Size: 0},
+		{NameHash: 0xCAFEBABE, LocalOffset: 3, TotalOffset: 3, Size: 2000},
+	}
+	testHeaders2003 = []Header{
+		{NameHash: 0x74377293, ArchiveID: 0, LocalOffset: 0, TotalOffset: 0, Size: 5, Checksum: 0xC0FFEE11},
+		{NameHash: 0xDEADBEEF, ArchiveID: 0, LocalOffset: 1, TotalOffset: 1, Size: 6, Checksum: 0x8BADF00D},
+		{NameHash: 0x12345678, ArchiveID: 1, LocalOffset: 0, TotalOffset: 2, Size: 7, Checksum: 0xFEEDFACE},
+	}
+)
+
+// encode2002 returns headers as ZDIR2002 records in the given byte order.
+func encode2002(t *testing.T, order binary.ByteOrder, headers []Header) []byte {
+	t.Helper()
+	records := make([]zdir2002, len(headers))
+	for i, hdr := range headers {
+		records[i] = zdir2002{NameHash: hdr.NameHash, LocalOffset: hdr.LocalOffset, Size: hdr.Size}
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, order, records); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// encode2003 returns headers as ZDIR2003 records in the given byte order.
+func encode2003(t *testing.T, order binary.ByteOrder, headers []Header) []byte {
+	t.Helper()
+	records := make([]zdir2003, len(headers))
+	for i, hdr := range headers {
+		records[i] = zdir2003(hdr)
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, order, records); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadHeaders(t *testing.T) {
+	zdir2002 := encode2002(t, binary.LittleEndian, testHeaders2002)
+	zdir2003 := encode2003(t, binary.LittleEndian, testHeaders2003)
+
+	tests := []struct {
+		name       string
+		data       []byte
+		format     Format
+		order      binary.ByteOrder
+		want       []Header
+		wantFormat Format
+	}{
+		{"2002 detected", zdir2002, FormatUnknown, binary.LittleEndian, testHeaders2002, Format2002},
+		{"2002 forced", zdir2002, Format2002, binary.LittleEndian, testHeaders2002, Format2002},
+		{"2003 forced", zdir2003, Format2003, binary.LittleEndian, testHeaders2003, Format2003},
+		{"2003 big endian", encode2003(t, binary.BigEndian, testHeaders2003), Format2003, binary.BigEndian, testHeaders2003, Format2003},
+		{"2002 even count detected", encode2002(t, binary.LittleEndian, testHeaders2002Even), FormatUnknown, binary.LittleEndian, testHeaders2002Even, Format2002},
+		{"2003 detected", zdir2003, FormatUnknown, binary.LittleEndian, testHeaders2003, Format2003},
+		{"2003 big endian detected", encode2003(t, binary.BigEndian, testHeaders2003), FormatUnknown, binary.BigEndian, testHeaders2003, Format2003},
+		{"empty", nil, FormatUnknown, binary.LittleEndian, []Header{}, Format2003},
+	}
+	for _, tt := range tests {
+		got, format, err := ReadHeaders(bytes.NewReader(tt.data), int64(len(tt.data)), tt.format, tt.order)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if format != tt.wantFormat {
+			t.Errorf("%s: format %s, want %s", tt.name, format, tt.wantFormat)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadHeadersInvalidSize(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		format Format
+	}{
+		{"no layout", 13, FormatUnknown},
+		{"partial 2002 record", 18, Format2002},
+		{"partial 2003 record", 36, Format2003},
+	}
+	for _, tt := range tests {
+		data := make([]byte, tt.size)
+		_, _, err := ReadHeaders(bytes.NewReader(data), int64(len(data)), tt.format, binary.LittleEndian)
+		if !errors.Is(err, ErrInvalidZDIRSize) {
+			t.Errorf("%s: got %v, want ErrInvalidZDIRSize", tt.name, err)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		size     int64
+		want     Format
+		wantSure bool
+	}{
+		{12, Format2002, true},
+		{36, Format2002, true},
+		{13, FormatUnknown, false},
+		{25, FormatUnknown, false},
+	}
+	for _, tt := range tests {
+		got, sure := DetectFormat(nil, tt.size, binary.LittleEndian)
+		if got != tt.want || sure != tt.wantSure {
+			t.Errorf("DetectFormat(%d bytes) = %s, %t, want %s, %t", tt.size, got, sure, tt.want, tt.wantSure)
+		}
+	}
+}
+
+func TestIsAmbiguous(t *testing.T) {
+	tests := []struct {
+		size int64
+		want bool
+	}{
+		{0, false},
+		{12, false},
+		{24, true},
+		{36, false},
+		{48, true},
+		{24 * 1001, true},
+	}
+	for _, tt := range tests {
+		if got := IsAmbiguous(tt.size); got != tt.want {
+			t.Errorf("IsAmbiguous(%d) = %t, want %t", tt.size, got, tt.want)
+		}
+	}
+}
+
+// TestDetectFormatAmbiguous covers directories of 24*n bytes, which hold
+// either 2n ZDIR2002 records or n ZDIR2003 records.
+func TestDetectFormatAmbiguous(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		order    binary.ByteOrder
+		want     Format
+		wantSure bool
+	}{
+		{"2002", encode2002(t, binary.LittleEndian, testHeaders2002Even), binary.LittleEndian, Format2002, true},
+		{"2003", encode2003(t, binary.LittleEndian, testHeaders2003), binary.LittleEndian, Format2003, true},
+		{"2002 big endian", encode2002(t, binary.BigEndian, testHeaders2002Even), binary.BigEndian, Format2002, true},
+		{"2003 big endian", encode2003(t, binary.BigEndian, testHeaders2003), binary.BigEndian, Format2003, true},
+		// Zeroes look like real entries either way
+		{"undecided", make([]byte, 48), binary.LittleEndian, Format2003, false},
+		// Checksums read as ZDIR2002 sizes are far too large
+		{"2003 with one window", encode2003(t, binary.LittleEndian, testHeaders2003[:1]), binary.LittleEndian, Format2003, true},
+	}
+	for _, tt := range tests {
+		got, sure := DetectFormat(tt.data, int64(len(tt.data)), tt.order)
+		if got != tt.want || sure != tt.wantSure {
+			t.Errorf("%s: got %s, %t, want %s, %t", tt.name, got, sure, tt.want, tt.wantSure)
+		}
+	}
+}
+
+func TestResolveOffset(t *testing.T) {
+	tests := []struct {
+		localOffset uint32
+		shift       uint
+		want        int64
+		wantErr     bool
+	}{
+		{0, OffsetShift, 0, false},
+		{1, OffsetShift, 2048, false},
+		{3, 4, 48, false},
+		{5, 0, 5, false},
+		{0xFFFFFFFF, 0, 0xFFFFFFFF, false},
+		{0xFFFFFFFF, OffsetShift, 0xFFFFFFFF << 11, false},
+		{0xFFFFFFFF, 31, 0xFFFFFFFF << 31, false},
+		{0xFFFFFFFF, 32, 0, true},
+		{0xFFFFFFFF, 63, 0, true},
+		{0, 63, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ResolveOffset(Header{LocalOffset: tt.localOffset}, tt.shift)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ResolveOffset(%#x, %d) = %d, want an overflow error", tt.localOffset, tt.shift, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ResolveOffset(%#x, %d): %v", tt.localOffset, tt.shift, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ResolveOffset(%#x, %d) = %d, want %d", tt.localOffset, tt.shift, got, tt.want)
+		}
+	}
+}
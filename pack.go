@@ -0,0 +1,88 @@
+package nfstools
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Pack stores every regular file below root in data, each one aligned to
+// 1<<shift bytes, and writes the matching ZDIR2002 records to zdir. Files
+// are named by their path relative to root with backslash separators and
+// hashed with hasher. Shifts above 31 are rejected, as they align every
+// file to more than 2 GiB.
+func Pack(root string, data, zdir io.Writer, shift uint, hasher Hasher) ([]Header, error) {
+	if shift > 31 {
+		return nil, fmt.Errorf("offset shift %d is above 31", shift)
+	}
+
+	var headers []Header
+	var offset int64
+	names := make(map[uint32]string)
+	align := int64(1) << shift
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := strings.ReplaceAll(filepath.ToSlash(rel), "/", `\`)
+		hash := hasher.Hash(name)
+		if other, ok := names[hash]; ok {
+			return fmt.Errorf("%q and %q share hash %08X", other, name, hash)
+		}
+		names[hash] = name
+
+		n, err := packFile(data, p)
+		if err != nil {
+			return err
+		}
+		if n > math.MaxUint32 || offset>>shift > math.MaxUint32 {
+			return fmt.Errorf("%s: does not fit in a ZDIR2002 record", name)
+		}
+		headers = append(headers, zdir2002{
+			NameHash:    hash,
+			LocalOffset: uint32(offset >> shift),
+			Size:        uint32(n),
+		}.header())
+
+		// Pad up to the next aligned offset
+		offset += n
+		if pad := (align - offset%align) % align; pad > 0 {
+			if _, err := data.Write(make([]byte, pad)); err != nil {
+				return err
+			}
+			offset += pad
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]zdir2002, len(headers))
+	for i, hdr := range headers {
+		records[i] = zdir2002{NameHash: hdr.NameHash, LocalOffset: hdr.LocalOffset, Size: hdr.Size}
+	}
+	return headers, binary.Write(zdir, binary.LittleEndian, records)
+}
+
+func packFile(w io.Writer, name string) (int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, bufferSize)
+	return io.CopyBuffer(w, f, buf)
+}